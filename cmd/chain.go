@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/manifest"
+	"github.com/AppleGamer22/recursive-backup/internal/utils"
+)
+
+const (
+	// opLogCopyFinished starts the operation log line of a cp run that went through all of its batches
+	opLogCopyFinished = "cp finished for all batches"
+	// opLogListSource starts the operation log line naming the source of a run
+	opLogListSource = "list source: "
+)
+
+var sinceLastPath string
+var againstManifestPath string
+
+// baselineManifest is the manifest the listing is compared with, nil unless against-manifest is used
+var baselineManifest *manifest.Manifest
+
+// chainParentPath is the project whose start time is the reference time of this run, empty unless since-last is used
+var chainParentPath string
+
+// parseReferenceTime sets the reference time of lt and diff from the time flag, or from the start of the last successful
+// project found by the since-last flag. With the against-manifest flag it loads the baseline manifest instead.
+func parseReferenceTime() error {
+	switch {
+	case len(againstManifestPath) > 0 && (len(sinceLastPath) > 0 || len(timeString) > 0):
+		return errors.New("against-manifest flag cannot be used with the time or since-last flags")
+	case len(againstManifestPath) > 0:
+		var err error
+		if againstManifestPath, err = resolveManifestPath(againstManifestPath); err != nil {
+			return err
+		}
+		baselineManifest, err = readManifestFile(againstManifestPath)
+		return err
+	case len(sinceLastPath) > 0 && len(timeString) > 0:
+		return errors.New("time and since-last flags cannot be used together")
+	case len(sinceLastPath) > 0:
+		projectPath, startTime, err := findLastSuccessfulProject(sinceLastPath)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reference time %s, the start of %s\n", startTime.Format(timeDateFormat), projectPath)
+		cfg.ReferenceTime = &startTime
+		chainParentPath = projectPath
+		return nil
+	case len(timeString) == 0:
+		return errors.New("time string cannot be empty, set the time, since-last or against-manifest flag")
+	default:
+		assertedTime, err := parseTime(timeString)
+		if err != nil {
+			return fmt.Errorf("failed to parse time flag value: %v", err)
+		}
+		cfg.ReferenceTime = assertedTime
+		return nil
+	}
+}
+
+// findLastSuccessfulProject returns the project at path, or the newest project in the directory at path,
+// whose cp went through all of its batches with no failed copies left, and the time its listing started.
+// Projects of another source are skipped.
+func findLastSuccessfulProject(path string) (string, time.Time, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	projectPaths := []string{path}
+	if !regexp.MustCompile(parentDirNameRegexp).MatchString(path) {
+		if projectPaths, err = filepath.Glob(filepath.Join(path, fmt.Sprintf(parentDirNamePattern, "*"))); err != nil {
+			return "", time.Time{}, err
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(projectPaths)))
+	}
+	for _, projectPath := range projectPaths {
+		startTime, err := successfulProjectStartTime(projectPath)
+		if err != nil {
+			fmt.Printf("skipping project %s: %v\n", projectPath, err)
+			continue
+		}
+		return projectPath, startTime, nil
+	}
+	return "", time.Time{}, fmt.Errorf("no successful project of %s found in %s", cfg.Src, path)
+}
+
+// successfulProjectStartTime returns the time the listing of a project started, or why it cannot be a chain parent
+func successfulProjectStartTime(projectPath string) (time.Time, error) {
+	opLogPath := filepath.Join(projectPath, operationLogFileName)
+	startTime, err := utils.GetLastBackupExecutionTime(opLogPath)
+	if err != nil {
+		return startTime, err
+	}
+	source, copyFinished, err := scanOpLog(opLogPath)
+	if err != nil {
+		return startTime, err
+	}
+	if len(source) > 0 {
+		currentSource, err := filepath.Abs(cfg.Src)
+		if err != nil {
+			return startTime, err
+		}
+		if source != currentSource {
+			return startTime, fmt.Errorf("its source is %s", source)
+		}
+	}
+	if !copyFinished {
+		return startTime, errors.New("its copy did not finish")
+	}
+	pendingBatches, err := filepath.Glob(filepath.Join(projectPath, fmt.Sprintf(sliceBatchesDirNamePattern, "*"), sliceBatchesToDoDirName, "*"))
+	if err != nil {
+		return startTime, err
+	}
+	if len(pendingBatches) > 0 {
+		return startTime, fmt.Errorf("%d of its batches were not copied", len(pendingBatches))
+	}
+	failedPaths, err := collectFailedCopies(projectPath)
+	if err != nil {
+		return startTime, err
+	}
+	if len(failedPaths) > 0 {
+		return startTime, fmt.Errorf("%d of its copies failed", len(failedPaths))
+	}
+	return startTime, nil
+}
+
+// scanOpLog returns the source named by an operation log, empty for logs written before it was named,
+// and whether a cp run went through all of its batches
+func scanOpLog(opLogPath string) (source string, copyFinished bool, err error) {
+	file, err := os.Open(opLogPath)
+	if err != nil {
+		return "", false, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, opLogListSource):
+			// the line ends with the RFC1123Z time of writeOpLog, which has 6 space separated fields
+			fields := strings.Split(strings.TrimPrefix(line, opLogListSource), " ")
+			if len(fields) > 6 {
+				source = strings.Join(fields[:len(fields)-6], " ")
+			}
+		case strings.HasPrefix(line, opLogCopyFinished):
+			copyFinished = true
+		}
+	}
+	return source, copyFinished, scanner.Err()
+}
+
+// recordChainParent records the project this run continues in the project dir and the operation log
+func recordChainParent() error {
+	if len(chainParentPath) == 0 {
+		return nil
+	}
+	parentFilePath := filepath.Join(rootDirPath, chainParentFileName)
+	if err := os.WriteFile(parentFilePath, []byte(chainParentPath+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to record the chain parent project: %w", err)
+	}
+	return writeOpLog(fmt.Sprintf("chain parent: %s, reference time %s", chainParentPath, cfg.ReferenceTime.Format(timeDateFormat)))
+}
@@ -1,40 +1,59 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
-	"sync"
 	"time"
 
+	"github.com/AppleGamer22/recursive-backup/internal/utils"
 	"github.com/AppleGamer22/recursive-backup/internal/workers"
 
 	"github.com/AppleGamer22/recursive-backup/internal/manager"
 	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+	"github.com/AppleGamer22/recursive-backup/internal/throttle"
 	"github.com/spf13/cobra"
 )
 
 var batchesDirPath string
+var resumeCopy bool
 var copyQueueLen uint
+var preserveAttributes string
+var checksumAlgorithm string
+var chunkThreshold string
+var chunkSize string
+var retryPolicy workers.RetryPolicy
+var retryOn string
+var poolOptions workers.PoolOptions
+var bandwidthLimit string
+var bandwidthSchedule string
+var preserveHardLinks bool
+var sparseCopies bool
+var sparseZeroRuns bool
+var skipUnchanged string
+var linkDestPath string
+var rateLimiter *throttle.Limiter
 var generalRequestChannel chan tasks.GeneralRequest
-var responseChan chan tasks.BackupFileResponse
-var wgCopyWorkerQuitConfirmation sync.WaitGroup
 var digitsRE = regexp.MustCompile("[[:digit:]]+")
 var in manager.ServiceInitInput
 var service manager.API
-
-func UpdateOnQuit() {
-	wgCopyWorkerQuitConfirmation.Done()
-}
+var copyCtx context.Context
 
 func init() {
 	cpCmd.Flags().StringVarP(&rootDirPath, "project", "p", "", "mandatory flag: project root path")
-	cpCmd.Flags().StringVarP(&batchesDirPath, "batches-dir-path", "b", "", "mandatory flag: copy batches directory path")
-	cpCmd.Flags().UintVarP(&copyQueueLen, "copy-queue-len", "q", 200, "copy queue length")
+	cpCmd.Flags().StringVarP(&batchesDirPath, "batches-dir-path", "b", "", "mandatory flag unless resuming: copy batches directory path")
+	cpCmd.Flags().BoolVar(&resumeCopy, "resume", false, "resume an interrupted cp run, skipping files already copied by the in-flight batch (defaults to the project's latest batches dir)")
+	addCopyFlags(cpCmd)
+	addNullFlag(cpCmd)
+	addSymlinksFlag(cpCmd)
+	addSpecialFlag(cpCmd)
+	cpCmd.Flags().StringVar(&linkDestPath, "link-dest", "", linkDestFlagUsage)
 	rootCmd.AddCommand(cpCmd)
 }
 
@@ -54,14 +73,85 @@ var cpCmd = &cobra.Command{
 		if len(rootDirPath) == 0 {
 			return errors.New("rootDirPath must be specified")
 		}
+		if len(batchesDirPath) == 0 && resumeCopy {
+			var err error
+			if batchesDirPath, err = findLatestBatchesDir(); err != nil {
+				return err
+			}
+			fmt.Printf("resuming batches in %s\n", batchesDirPath)
+		}
 		if len(batchesDirPath) == 0 {
 			return errors.New("batchesDirPath must be specified")
 		}
 		batchesToDoDirPath = filepath.Join(batchesDirPath, sliceBatchesToDoDirName)
 		batchesDoneDirPath = filepath.Join(batchesDirPath, sliceBatchesDoneDirName)
+		preserve, err := tasks.ParsePreserveOptions(preserveAttributes)
+		if err != nil {
+			return err
+		}
+		if err = tasks.ValidateChecksumAlgorithm(checksumAlgorithm); err != nil {
+			return err
+		}
+		if err = tasks.ValidateSymlinks(symlinkPolicy); err != nil {
+			return err
+		}
+		if err = tasks.ValidateSkipUnchanged(skipUnchanged); err != nil {
+			return err
+		}
+		special, err := tasks.ParseSpecialFilePolicy(specialPolicy)
+		if err != nil {
+			return err
+		}
+		threshold, err := utils.ParseByteSize(chunkThreshold)
+		if err != nil {
+			return fmt.Errorf("failed to parse chunk-threshold flag value: %v", err)
+		}
+		size, err := utils.ParseByteSize(chunkSize)
+		if err != nil {
+			return fmt.Errorf("failed to parse chunk-size flag value: %v", err)
+		}
+		if threshold > 0 && size <= 0 {
+			return errors.New("chunk-size must be positive when chunked copies are enabled")
+		}
+		if retryPolicy.RetryableErrors, err = workers.ParseRetryableErrors(retryOn); err != nil {
+			return err
+		}
+		if retryPolicy.Jitter < 0 || retryPolicy.Jitter > 1 {
+			return errors.New("retry-jitter must be between 0 and 1")
+		}
+		if cfg.NumWorkers == 0 {
+			return errors.New("workers must be at least 1")
+		}
+		if poolOptions.Adaptive && poolOptions.MaxWorkers < cfg.NumWorkers {
+			return errors.New("max-workers must not be lower than workers")
+		}
+		poolOptions.Workers = cfg.NumWorkers
+		if rateLimiter, err = newRateLimiter(); err != nil {
+			return err
+		}
 		in = manager.ServiceInitInput{
 			SourceRootDir: cfg.Src,
 			TargetRootDir: cfg.Target,
+			CopyOptions: tasks.CopyOptions{
+				Preserve:          preserve,
+				ChecksumAlgorithm: checksumAlgorithm,
+				ChunkThreshold:    threshold,
+				ChunkSize:         size,
+				Sparse:            sparseCopies,
+				SparseZeroRuns:    sparseZeroRuns,
+				SkipUnchanged:     skipUnchanged,
+			},
+			NullDelimited: nullDelimited,
+			Symlinks:      symlinkPolicy,
+			Special:       special,
+		}
+		if preserveHardLinks {
+			in.CopyOptions.HardLinks = tasks.NewHardLinks()
+		}
+		if len(linkDestPath) > 0 {
+			if in.CopyOptions.LinkDest, err = newLinkDest(); err != nil {
+				return err
+			}
 		}
 		service = manager.NewService(in)
 
@@ -70,30 +160,113 @@ var cpCmd = &cobra.Command{
 	RunE: cpRunCommand,
 }
 
+// addCopyFlags registers the cp stage flags on every command that runs it
+func addCopyFlags(cmd *cobra.Command) {
+	cmd.Flags().UintVarP(&cfg.NumWorkers, "workers", "w", defaultWorkers, workersFlagUsage)
+	cmd.Flags().UintVarP(&copyQueueLen, "queue-len", "q", defaultQueueLen, queueLenFlagUsage)
+	cmd.Flags().UintVar(&copyQueueLen, "copy-queue-len", defaultQueueLen, queueLenFlagUsage)
+	_ = cmd.Flags().MarkDeprecated("copy-queue-len", "use --queue-len, and --workers for the number of concurrent copies")
+	cmd.Flags().BoolVar(&poolOptions.Adaptive, "adaptive-workers", false, adaptiveWorkersFlagUsage)
+	cmd.Flags().UintVar(&poolOptions.MaxWorkers, "max-workers", defaultMaxWorkers, maxWorkersFlagUsage)
+	cmd.Flags().DurationVar(&poolOptions.Interval, "adaptive-interval", workers.DefaultAdaptiveInterval, adaptiveIntervalFlagUsage)
+	cmd.Flags().StringVar(&bandwidthLimit, "bwlimit", "0", bwLimitFlagUsage)
+	cmd.Flags().StringVar(&bandwidthSchedule, "bwlimit-schedule", "", bwLimitScheduleFlagUsage)
+	cmd.Flags().StringVar(&preserveAttributes, "preserve", defaultPreserveAttributes, preserveFlagUsage)
+	cmd.Flags().StringVar(&checksumAlgorithm, "verify", tasks.ChecksumNone, verifyFlagUsage)
+	cmd.Flags().StringVar(&chunkThreshold, "chunk-threshold", defaultChunkThreshold, chunkThresholdFlagUsage)
+	cmd.Flags().StringVar(&chunkSize, "chunk-size", defaultChunkSize, chunkSizeFlagUsage)
+	cmd.Flags().UintVar(&retryPolicy.MaxAttempts, "retry-attempts", defaultRetryAttempts, retryAttemptsFlagUsage)
+	cmd.Flags().DurationVar(&retryPolicy.BaseDelay, "retry-delay", defaultRetryDelay, retryDelayFlagUsage)
+	cmd.Flags().DurationVar(&retryPolicy.MaxDelay, "retry-max-delay", defaultRetryMaxDelay, retryMaxDelayFlagUsage)
+	cmd.Flags().Float64Var(&retryPolicy.Jitter, "retry-jitter", defaultRetryJitter, retryJitterFlagUsage)
+	cmd.Flags().StringVar(&retryOn, "retry-on", workers.DefaultRetryOn, retryOnFlagUsage)
+	cmd.Flags().BoolVar(&preserveHardLinks, "hard-links", true, hardLinksFlagUsage)
+	cmd.Flags().BoolVar(&sparseCopies, "sparse", true, sparseFlagUsage)
+	cmd.Flags().BoolVar(&sparseZeroRuns, "sparse-zero-runs", false, sparseZeroRunsFlagUsage)
+	cmd.Flags().StringVar(&skipUnchanged, "skip-unchanged", tasks.SkipUnchangedNever, skipUnchangedFlagUsage)
+}
+
+// newLinkDest returns the link-dest option comparing the sources with their copies by the skip-unchanged mode
+func newLinkDest() (*tasks.LinkDest, error) {
+	linkDest := &tasks.LinkDest{}
+	var err error
+	if linkDest.Dir, err = filepath.Abs(linkDestPath); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(linkDest.Dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("link-dest %s is not a directory", linkDestPath)
+	}
+	if linkDest.TargetRootDir, err = filepath.Abs(cfg.Target); err != nil {
+		return nil, err
+	}
+	if skipUnchanged != tasks.SkipUnchangedNever {
+		linkDest.Compare = skipUnchanged
+	}
+	return linkDest, nil
+}
+
+// newRateLimiter returns the limiter shared by all copy workers, or nil when neither a limit nor a schedule is set
+func newRateLimiter() (*throttle.Limiter, error) {
+	rate, err := throttle.ParseRate(bandwidthLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bwlimit flag value: %v", err)
+	}
+	schedule, err := throttle.ParseSchedule(bandwidthSchedule, rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bwlimit-schedule flag value: %v", err)
+	}
+	if rate == throttle.Unlimited && len(schedule.Windows) == 0 {
+		return nil, nil
+	}
+	return throttle.NewLimiter(schedule), nil
+}
+
 func cpRunCommand(_ *cobra.Command, _ []string) error {
-	_ = writeOpLog(fmt.Sprintf("cp start for batches in %s", batchesDirPath))
+	var stopSignalHandling func()
+	copyCtx, stopSignalHandling = newSignalContext()
+	defer stopSignalHandling()
+	_ = writeOpLog(fmt.Sprintf("cp start for batches in %s (preserve: %s, verify: %s, workers: %d, adaptive: %t, queue length: %d, hard links: %t, sparse: %t, sparse zero runs: %t, skip unchanged: %s, link-dest: %q)",
+		batchesDirPath, in.CopyOptions.Preserve, checksumAlgorithm, poolOptions.Workers, poolOptions.Adaptive, copyQueueLen, preserveHardLinks, sparseCopies, sparseZeroRuns, skipUnchanged, linkDestPath))
 
-	responseChan = make(chan tasks.BackupFileResponse, copyQueueLen)
-	defer func() {
-		service.WaitForAllResponses()
-		close(responseChan)
-	}()
+	summary := newCopySummary(rateLimiter)
 	generalRequestChannel = make(chan tasks.GeneralRequest, copyQueueLen)
+	pool, err := workers.NewPool(&workers.NewPoolInput{
+		Options: poolOptions,
+		Worker: workers.NewCopyWorkerInput{
+			SourceRootPath: cfg.Src,
+			TargetRootPath: cfg.Target,
+			Pipeline:       generalRequestChannel,
+			RetryPolicy:    retryPolicy,
+			Context:        copyCtx,
+			OnResponse:     summary.observe,
+			RateLimiter:    rateLimiter,
+		},
+		OnResize: func(from, to uint, throughput, errorRate float64) {
+			msg := fmt.Sprintf("cp resized the worker pool from %d to %d workers (%.2f MiB/s, %.1f%% failed copies)",
+				from, to, throughput/(1<<20), errorRate*100)
+			fmt.Println(msg)
+			_ = writeOpLog(msg)
+		},
+	})
+	if err != nil {
+		return err
+	}
 	defer func() {
-		wgCopyWorkerQuitConfirmation.Wait()
+		pool.Stop()
 		close(generalRequestChannel)
 	}()
-	for i := 1; i <= int(copyQueueLen); i++ {
-		wgCopyWorkerQuitConfirmation.Add(1)
-		workers.NewCopyWorker(uint(i), cfg.Src, cfg.Target, generalRequestChannel, UpdateOnQuit)
-	}
-
-	err := filepath.WalkDir(batchesToDoDirPath, walkDirFunc)
-	_ = writeOpLog("cp finished for all batches")
 
-	for i := 0; i < int(copyQueueLen); i++ {
-		generalRequestChannel <- tasks.QuitRequest{}
+	err = filepath.WalkDir(batchesToDoDirPath, walkDirFunc)
+	if copyCtx.Err() != nil {
+		_ = writeOpLog(fmt.Sprintf("cp interrupted, run cp --resume -b \"%s\" to continue", batchesDirPath))
+		err = fmt.Errorf("cp interrupted: %w", copyCtx.Err())
+	} else if err != nil {
+		_ = writeOpLog(fmt.Sprintf("cp stopped before all batches were copied (%v)", err))
+	} else {
+		_ = writeOpLog(fmt.Sprintf("cp finished for all batches with %d workers", pool.Size()))
 	}
+	fmt.Println(summary)
+	_ = writeOpLog(summary.String())
 	return err
 }
 
@@ -102,49 +275,125 @@ func walkDirFunc(path string, d fs.DirEntry, err error) error {
 	case err != nil:
 		_ = writeOpLog(fmt.Sprintf("error with dir entry. path: %s. error: %s", path, err.Error()))
 		return err
+	case copyCtx.Err() != nil:
+		return copyCtx.Err()
 	case d.Type().IsDir():
 		return nil
 	case d.Type().IsRegular():
-		_ = writeOpLog(fmt.Sprintf("cp start for batch %s", path))
-		file, err := os.Open(path)
+		return copyBatch(path)
+	default:
+		return nil
+	}
+}
+
+// copyBatch requests the copy of every file in the batch file and waits for all of their responses,
+// so a batch file is moved to the done dir only once its copy log is complete
+func copyBatch(path string) error {
+	_ = writeOpLog(fmt.Sprintf("cp start for batch %s", path))
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	batchFileBasePath := filepath.Base(path)
+	batchIDString := digitsRE.FindString(batchFileBasePath)
+	batchID, err := strconv.Atoi(batchIDString)
+	if err != nil {
+		return fmt.Errorf("failed to extract batch number from %s", path)
+	}
+	if err = removeOrphanedTempFiles(file); err != nil {
+		return err
+	}
+
+	var filesList io.Reader = file
+	var copyLogFile *os.File
+	handleResponses := service.HandleFilesCopyResponse
+	if resumeCopy {
+		copyLogFilePath, succeeded, err := findResumableCopyLog(uint(batchID))
 		if err != nil {
 			return err
 		}
-		batchFileBasePath := filepath.Base(path)
-		batchIDString := digitsRE.FindString(batchFileBasePath)
-		batchID, err := strconv.Atoi(batchIDString)
-		if err != nil {
-			return fmt.Errorf("failed to extract batch number from %s", path)
-		}
-
-		now := time.Now().Format(timeDateFormat)
-		copyLogDirName := fmt.Sprintf(copyLogDirPattern, now)
-		copyLogDirPath := filepath.Join(rootDirPath, copyLogDirName)
-		if err = os.MkdirAll(copyLogDirPath, 0755); err != nil {
-			return fmt.Errorf("failed to create copy log Dir. Error: %v", err)
+		if len(copyLogFilePath) > 0 {
+			if filesList, err = filterCopiedFiles(file, succeeded); err != nil {
+				return err
+			}
+			if copyLogFile, err = openCopyLogForAppend(copyLogFilePath); err != nil {
+				return err
+			}
+			handleResponses = service.AppendFilesCopyResponse
+			_ = writeOpLog(fmt.Sprintf("cp resume batch %s skipping %d copied files, appending to %s", path, len(succeeded), copyLogFilePath))
+			fmt.Println(copyLogFilePath)
 		}
-		copyLogFileName := fmt.Sprintf(copyBatchLogFileNamePattern, batchID)
-		copyLogFilePath := filepath.Join(copyLogDirPath, copyLogFileName)
-		copyLogFile, err := os.Create(copyLogFilePath)
-		if err != nil {
-			return fmt.Errorf("failed to create copy log file. Error: %v", err)
+	}
+	if copyLogFile == nil {
+		if copyLogFile, err = createCopyLogFile(uint(batchID)); err != nil {
+			return err
 		}
-		fmt.Println(copyLogFilePath)
-
-		go service.HandleFilesCopyResponse(copyLogFile, responseChan)
-		service.RequestFilesCopy(file, uint(batchID), generalRequestChannel, responseChan)
-		_ = file.Close()
-		donePath := filepath.Join(batchesDoneDirPath, batchFileBasePath)
+	}
+	defer func() {
+		_ = copyLogFile.Close()
+	}()
 
-		if err = os.Rename(path, donePath); err != nil {
-			_ = writeOpLog(fmt.Sprintf("failed to move batch file to done dir %s (%v)", path, err))
-		} else {
-			fmt.Printf("%s -> %s\n", path, donePath)
-		}
-		_ = writeOpLog(fmt.Sprintf("cp finished for batch %s\n", path))
-	default:
-		return nil
+	batchResponseChan := make(chan tasks.BackupFileResponse, copyQueueLen)
+	handlerDone := make(chan struct{})
+	go func() {
+		handleResponses(copyLogFile, batchResponseChan)
+		close(handlerDone)
+	}()
+	requestErr := service.RequestFilesCopyContext(copyCtx, filesList, uint(batchID), generalRequestChannel, batchResponseChan)
+	service.WaitForAllResponses()
+	close(batchResponseChan)
+	<-handlerDone
+	if copyCtx.Err() != nil {
+		_ = writeOpLog(fmt.Sprintf("cp interrupted in batch %s, the batch stays in the todo dir (%v)", path, requestErr))
+		return copyCtx.Err()
+	}
+	if requestErr != nil {
+		_ = writeOpLog(fmt.Sprintf("failed to read batch file %s (%v)", path, requestErr))
 	}
 
+	donePath := filepath.Join(batchesDoneDirPath, batchFileBasePath)
+	if err = os.Rename(path, donePath); err != nil {
+		_ = writeOpLog(fmt.Sprintf("failed to move batch file to done dir %s (%v)", path, err))
+	} else {
+		fmt.Printf("%s -> %s\n", path, donePath)
+	}
+	_ = writeOpLog(fmt.Sprintf("cp finished for batch %s\n", path))
 	return nil
 }
+
+// removeOrphanedTempFiles deletes the temp files that interrupted copies left in the target dirs of the batch file,
+// then rewinds it for the copies of the batch
+func removeOrphanedTempFiles(batchFile *os.File) error {
+	removed, err := service.RemoveOrphanedTempFiles(batchFile)
+	if err != nil {
+		_ = writeOpLog(fmt.Sprintf("failed to remove orphaned temp files for batch %s (%v)", batchFile.Name(), err))
+	}
+	for _, path := range removed {
+		fmt.Printf("removed orphaned temp file %s\n", path)
+	}
+	if len(removed) > 0 {
+		_ = writeOpLog(fmt.Sprintf("cp removed %d orphaned temp files for batch %s", len(removed), batchFile.Name()))
+	}
+	_, err = batchFile.Seek(0, io.SeekStart)
+	return err
+}
+
+func createCopyLogFile(batchID uint) (*os.File, error) {
+	now := time.Now().Format(timeDateFormat)
+	copyLogDirName := fmt.Sprintf(copyLogDirPattern, now)
+	copyLogDirPath := filepath.Join(rootDirPath, copyLogDirName)
+	if err := os.MkdirAll(copyLogDirPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create copy log Dir. Error: %v", err)
+	}
+	copyLogFileName := fmt.Sprintf(copyBatchLogFileNamePattern, batchID)
+	copyLogFilePath := filepath.Join(copyLogDirPath, copyLogFileName)
+	copyLogFile, err := os.Create(copyLogFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create copy log file. Error: %v", err)
+	}
+	fmt.Println(copyLogFilePath)
+	return copyLogFile, nil
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"errors"
-	"fmt"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
@@ -11,8 +10,11 @@ import (
 var timeString string
 
 func init() {
-	diffCmd.Flags().UintVarP(&copyQueueLen, "copy-queue-len", "q", 200, "copy queue length")
+	addListFlags(diffCmd)
+	addCopyFlags(diffCmd)
 	diffCmd.Flags().StringVarP(&timeString, "time", "t", "", "reference time with format: 20060102T150405")
+	diffCmd.Flags().StringVar(&sinceLastPath, "since-last", "", sinceLastFlagUsage)
+	diffCmd.Flags().StringVar(&againstManifestPath, "against-manifest", "", againstManifestFlagUsage)
 	rootCmd.AddCommand(diffCmd)
 }
 
@@ -27,16 +29,7 @@ var diffCmd = &cobra.Command{
 		cfg.Src = args[0]
 		cfg.Target = args[1]
 
-		if timeString == "" {
-			return errors.New("time string cannot be empty")
-		}
-		assertedTime, err := parseTime(timeString)
-		if err != nil {
-			return fmt.Errorf("failed to parse time flag value: %v", err)
-		}
-		cfg.ReferenceTime = assertedTime
-
-		return nil
+		return parseReferenceTime()
 	},
 	PreRunE: fullCmd.PreRunE,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -71,6 +64,6 @@ var diffCmd = &cobra.Command{
 			return err
 		}
 
-		return nil
+		return writeManifest()
 	},
 }
@@ -8,11 +8,14 @@ import (
 )
 
 func init() {
+	// ls dependency
+	addListFlags(fullCmd)
+
 	// slice dependency
 	fullCmd.Flags().UintVarP(&batchSize, "batch-size", "s", defaultBatchSize, "maximum number of files in a batch")
 
 	// cp dependency
-	fullCmd.Flags().UintVarP(&copyQueueLen, "copy-queue-len", "q", 200, "copy queue length")
+	addCopyFlags(fullCmd)
 
 	rootCmd.AddCommand(fullCmd)
 }
@@ -62,6 +65,6 @@ var fullCmd = &cobra.Command{
 			return err
 		}
 
-		return nil
+		return writeManifest()
 	},
 }
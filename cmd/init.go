@@ -14,6 +14,7 @@ import (
 const (
 	parentDirNameRegexp           = ".*" + string(filepath.Separator) + "rb_[[:digit:]]{8}T[[:digit:]]{6}$"
 	doneDirRegexp                 = ".*" + string(filepath.Separator) + "batches_[[:digit:]]{8}T[[:digit:]]{6}" + string(filepath.Separator) + "done"
+	snapshotDirRegexp             = "^[[:digit:]]{8}T[[:digit:]]{6}$"
 	timeDateFormat                = "20060102T150405"
 	parentDirNamePattern          = "rb_%s"
 	listDirName                   = "list"
@@ -25,6 +26,12 @@ const (
 	listedDirsFileNamePattern     = "list_dirs_%s.log"
 	listedFilesFileNamePattern    = "list_files_%s.log"
 	listErrorsFileNamePattern     = "list_errors_%s.log"
+	listHardLinksFileNamePattern  = "list_hardlinks_%s.log"
+	listSpecialFileNamePattern    = "list_special_%s.log"
+	listDeletionsFileNamePattern  = "list_deletions_%s.log"
+	listManifestFileNamePattern   = "list_manifest_%s.log"
+	listManifestFileNameGlob      = "list_manifest_*.log"
+	listChangesFileNamePattern    = "list_changes_%s.log"
 	skeletonDirsFileNamePattern   = "skeleton_dirs_%s.log"
 	skeletonErrorsFileNamePattern = "skeleton_errors_%s.log"
 	sliceBatchFileNamePattern     = "batch_%s%d.log"
@@ -32,8 +39,60 @@ const (
 	slicesWorkDirName             = "slice"
 	copyLogDirPattern             = "copy" + string(filepath.Separator) + "copy_logs_%s"
 	copyBatchLogFileNamePattern   = "copy_batch_%d.log"
+	copyBatchLogFileNameGlob      = "copy_batch_*.log"
+	retryFilesFileNamePattern     = "list_retry_%s.log"
 	operationLogFileName          = "oplog.log"
+	chainParentFileName           = "parent_project.log"
+	manifestFileName              = "manifest.csv"
 	defaultPerm                   = 0755
+	defaultPreserveAttributes     = "mode,timestamps"
+	defaultChunkThreshold         = "1GiB"
+	defaultChunkSize              = "64MiB"
+	chunkThresholdFlagUsage       = "size from which files are copied in resumable chunks, 0 disables chunked copies"
+	chunkSizeFlagUsage            = "chunk size of resumable copies"
+	excludeFlagUsage              = "gitignore style pattern of source entries not to list, repeatable"
+	includeFlagUsage              = "gitignore style pattern re-including entries otherwise excluded, repeatable, overrides --exclude and ignore files"
+	ignoreFileFlagUsage           = "name of the per directory file holding gitignore style exclude rules, empty disables ignore files"
+	minSizeFlagUsage              = "smallest listed file size, e.g. 1MiB"
+	maxSizeFlagUsage              = "largest listed file size, e.g. 4GiB, 0 is unlimited"
+	newerThanFlagUsage            = "list only files modified after this time (20060102T150405) or within this age, e.g. 72h or 7d"
+	olderThanFlagUsage            = "list only files modified before this time (20060102T150405) or age, e.g. 72h or 7d"
+	maxDepthFlagUsage             = "list entries up to this many levels below the source dir, 0 is unlimited"
+	listFormatFlagUsage           = "files list format: plain (one path per line), csv or jsonl (path, size, mtime, mode, inode and link count), for NUL terminated lists use the null flag"
+	listWorkersFlagUsage          = "number of source directories listed concurrently, speeds up high latency network shares"
+	listSortedFlagUsage           = "write the lists of several list-workers in the order of a single worker, holding them in memory"
+	specialFlagUsage              = "special file policy: skip, report (list them in the special files list) or recreate (also recreate them on the target, root for devices), for all types or per type, e.g. skip,fifo=recreate"
+	symlinksFlagUsage             = "symlink policy: skip (note them in the list errors), copy-link (recreate them on the target) or follow (back up what they point to)"
+	nullFlagUsage                 = "NUL terminated dirs and files lists, so paths may contain line breaks (plain list format only)"
+	defaultWorkers                = 16
+	defaultQueueLen               = 200
+	defaultMaxWorkers             = 64
+	workersFlagUsage              = "number of concurrent file copies, the initial number with --adaptive-workers"
+	queueLenFlagUsage             = "number of copy requests queued ahead of the workers"
+	adaptiveWorkersFlagUsage      = "grow or shrink the workers every adaptive-interval based on the observed throughput and failed copies"
+	maxWorkersFlagUsage           = "maximum number of workers with --adaptive-workers"
+	adaptiveIntervalFlagUsage     = "interval between adaptive worker pool adjustments"
+	bwLimitFlagUsage              = "total bandwidth of all copy workers, e.g. 20MiB/s, 0 is unlimited"
+	bwLimitScheduleFlagUsage      = "comma separated time of day bandwidth windows overriding bwlimit, e.g. 08:00-18:00=5MiB/s"
+	defaultRetryAttempts          = 3
+	defaultRetryDelay             = time.Second
+	defaultRetryMaxDelay          = time.Minute
+	defaultRetryJitter            = 0.2
+	retryAttemptsFlagUsage        = "maximum number of attempts per file, including the first one"
+	retryDelayFlagUsage           = "delay before the first retry, doubled on every further retry"
+	retryMaxDelayFlagUsage        = "maximum delay between retries"
+	retryJitterFlagUsage          = "fraction (0-1) by which retry delays are randomized"
+	retryOnFlagUsage              = "comma separated error classes to retry: eio, estale, etimedout, enospc, eagain, econnreset, checksum"
+	verifyFlagUsage               = "checksum algorithm for verifying copied files: none, sha256, blake3 or xxhash"
+	sinceLastFlagUsage            = "project dir, or dir of projects, whose last successful run started at the reference time, instead of the time flag"
+	againstManifestFlagUsage      = "manifest, or project dir holding it, of a previous backup; list the entries added or modified since then instead of those modified after a reference time"
+	deleteFlagUsage               = "target files and folders whose source was deleted are: reported in the deletions list, moved to the trash folder of the target, or removed"
+	skipUnchangedFlagUsage        = "leave targets matching their source as is: size-mtime (needs preserved timestamps), checksum or never"
+	sparseFlagUsage               = "leave the holes of sources as holes on the target instead of writing zeros"
+	sparseZeroRunsFlagUsage       = "with sparse, also leave zero runs of at least 64KiB in the data of sources as holes, for sources on filesystems that do not report their holes"
+	linkDestFlagUsage             = "target dir of a previous backup of the same source, files unchanged since then (see skip-unchanged, size-mtime by default) are hard linked to their copy in it"
+	hardLinksFlagUsage            = "recreate sources sharing an inode as hard links to the first copy of that inode in the run"
+	preserveFlagUsage             = "metadata to preserve on copied files: comma separated list of mode, timestamps and ownership (ownership requires root), or all/none"
 )
 
 var rootDirPath string
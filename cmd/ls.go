@@ -1,22 +1,161 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/AppleGamer22/recursive-backup/internal/filter"
+	"github.com/AppleGamer22/recursive-backup/internal/listfile"
 	"github.com/AppleGamer22/recursive-backup/internal/manager"
+	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+	"github.com/AppleGamer22/recursive-backup/internal/utils"
 	"github.com/spf13/cobra"
 )
 
 func init() {
+	addListFlags(lsCmd)
 	rootCmd.AddCommand(lsCmd)
 }
 
 var listDirPath string
 var listFilesPath string
 var listDirsPath string
+var listFilter filter.Options
+var listMinSize string
+var listMaxSize string
+var listNewerThan string
+var listOlderThan string
+var listMaxDepth int
+var listFormat string
+var nullDelimited bool
+var listWorkers int
+var listSorted bool
+var symlinkPolicy string
+var specialPolicy string
+
+// addListFlags registers the ls stage flags on every command that runs it
+func addListFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&listFilter.Excludes, "exclude", nil, excludeFlagUsage)
+	cmd.Flags().StringArrayVar(&listFilter.Includes, "include", nil, includeFlagUsage)
+	cmd.Flags().StringVar(&listFilter.IgnoreFileName, "ignore-file", filter.DefaultIgnoreFileName, ignoreFileFlagUsage)
+	cmd.Flags().StringVar(&listMinSize, "min-size", "0", minSizeFlagUsage)
+	cmd.Flags().StringVar(&listMaxSize, "max-size", "0", maxSizeFlagUsage)
+	cmd.Flags().StringVar(&listNewerThan, "newer-than", "", newerThanFlagUsage)
+	cmd.Flags().StringVar(&listOlderThan, "older-than", "", olderThanFlagUsage)
+	cmd.Flags().IntVar(&listMaxDepth, "max-depth", 0, maxDepthFlagUsage)
+	cmd.Flags().StringVar(&listFormat, "list-format", listfile.FormatPlain, listFormatFlagUsage)
+	cmd.Flags().IntVar(&listWorkers, "list-workers", 1, listWorkersFlagUsage)
+	cmd.Flags().BoolVar(&listSorted, "list-sorted", false, listSortedFlagUsage)
+	addNullFlag(cmd)
+	addSymlinksFlag(cmd)
+	addSpecialFlag(cmd)
+}
+
+// addNullFlag registers the NUL terminated lists flag on every command reading or writing dirs or files lists
+func addNullFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&nullDelimited, "null", "0", false, nullFlagUsage)
+}
+
+// addSymlinksFlag registers the symlink policy flag on every command listing, validating or copying the sources
+func addSymlinksFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&symlinkPolicy, "symlinks", tasks.SymlinksSkip, symlinksFlagUsage)
+}
+
+// addSpecialFlag registers the special file policy flag on every command listing or copying the sources
+func addSpecialFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&specialPolicy, "special", tasks.SpecialReport, specialFlagUsage)
+}
+
+// nullFlagArg returns the null flag for the printed follow-up commands, which must read the lists the same way
+func nullFlagArg() string {
+	if nullDelimited {
+		return " -0"
+	}
+	return ""
+}
+
+// listServiceInput returns the service input of the ls stage and records its filter and criteria in the oplog
+func listServiceInput() (manager.ServiceInitInput, error) {
+	criteria, err := parseListCriteria()
+	if err != nil {
+		return manager.ServiceInitInput{}, err
+	}
+	if err = listfile.ValidateFormat(listFormat); err != nil {
+		return manager.ServiceInitInput{}, err
+	}
+	if listFormat == listfile.FormatNull {
+		// the null flag terminates the dirs list by NUL as well and passes itself on to the follow-up commands
+		return manager.ServiceInitInput{}, fmt.Errorf("list format %s is not a files list format, use the null flag (-0/--null) for NUL terminated lists", listFormat)
+	}
+	if nullDelimited && listFormat != listfile.FormatPlain {
+		return manager.ServiceInitInput{}, fmt.Errorf("null flag requires the plain list format, got %s", listFormat)
+	}
+	if listWorkers < 1 {
+		return manager.ServiceInitInput{}, errors.New("list-workers must be at least 1")
+	}
+	if err = tasks.ValidateSymlinks(symlinkPolicy); err != nil {
+		return manager.ServiceInitInput{}, err
+	}
+	special, err := tasks.ParseSpecialFilePolicy(specialPolicy)
+	if err != nil {
+		return manager.ServiceInitInput{}, err
+	}
+
+	if source, err := filepath.Abs(cfg.Src); err == nil {
+		_ = writeOpLog(opLogListSource + source)
+	}
+	_ = writeOpLog(fmt.Sprintf("list filter: exclude %q, include %q, ignore file %q", listFilter.Excludes, listFilter.Includes, listFilter.IgnoreFileName))
+	_ = writeOpLog(fmt.Sprintf("list criteria: %s", criteria))
+	_ = writeOpLog(fmt.Sprintf("list format: %s, NUL terminated %t", listFormat, nullDelimited))
+	_ = writeOpLog(fmt.Sprintf("list workers: %d, sorted %t", listWorkers, listSorted))
+	_ = writeOpLog(fmt.Sprintf("list symlinks: %s", symlinkPolicy))
+	_ = writeOpLog(fmt.Sprintf("list special files: %s", special))
+	if baselineManifest != nil {
+		_ = writeOpLog(fmt.Sprintf("list baseline manifest: %s, %d entries", againstManifestPath, baselineManifest.Len()))
+	}
+	return manager.ServiceInitInput{
+		SourceRootDir: cfg.Src,
+		Filter:        listFilter,
+		ListCriteria:  criteria,
+		ListFormat:    listFormat,
+		NullDelimited: nullDelimited,
+		ListWorkers:   listWorkers,
+		ListSorted:    listSorted,
+		Symlinks:      symlinkPolicy,
+		Special:       special,
+		Baseline:      baselineManifest,
+	}, nil
+}
+
+func parseListCriteria() (tasks.ListCriteria, error) {
+	criteria := tasks.ListCriteria{MaxDepth: listMaxDepth}
+	var err error
+	if criteria.MinSize, err = utils.ParseByteSize(listMinSize); err != nil {
+		return criteria, fmt.Errorf("failed to parse min-size flag value: %v", err)
+	}
+	if criteria.MaxSize, err = utils.ParseByteSize(listMaxSize); err != nil {
+		return criteria, fmt.Errorf("failed to parse max-size flag value: %v", err)
+	}
+	now := time.Now()
+	if len(listNewerThan) > 0 {
+		newerThan, err := utils.ParseTimeOrAge(listNewerThan, timeDateFormat, now)
+		if err != nil {
+			return criteria, fmt.Errorf("failed to parse newer-than flag value: %v", err)
+		}
+		criteria.NewerThan = &newerThan
+	}
+	if len(listOlderThan) > 0 {
+		olderThan, err := utils.ParseTimeOrAge(listOlderThan, timeDateFormat, now)
+		if err != nil {
+			return criteria, fmt.Errorf("failed to parse older-than flag value: %v", err)
+		}
+		criteria.OlderThan = &olderThan
+	}
+	return criteria, criteria.Validate()
+}
 
 var lsCmd = &cobra.Command{
 	Use:   "ls [source-dir-path]",
@@ -53,21 +192,21 @@ func listRunCommand(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	dirs, files, errs, err := createFilesForList()
+	lists, err := createFilesForList()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		_ = dirs.Close()
-		_ = files.Close()
-		_ = errs.Close()
-	}()
+	defer lists.Close()
 
-	in := manager.ServiceInitInput{
-		SourceRootDir: cfg.Src,
+	in, err := listServiceInput()
+	if err != nil {
+		return err
 	}
+	in.HardLinks = lists.hardLinks
+	in.SpecialFiles = lists.special
+	in.Manifest = lists.manifest
 	service := manager.NewService(in)
-	if err = service.ListSources(dirs, files, errs, nil); err != nil {
+	if err = service.ListSources(lists.dirs, lists.files, lists.errs, nil); err != nil {
 		return err
 	}
 
@@ -77,39 +216,88 @@ func listRunCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	skeletonFormatString := "Run the following from the command line in order to create directories on the target directory:\n" +
-		"\t%s skeleton -d \"%s\" -p \"%s\" \"%s\" \"[target-dir-path]\"\n"
-	fmt.Printf(skeletonFormatString, os.Args[0], listDirsPath, rootDirPath, cfg.Src)
+		"\t%s skeleton%s -d \"%s\" -p \"%s\" \"%s\" \"[target-dir-path]\"\n"
+	fmt.Printf(skeletonFormatString, os.Args[0], nullFlagArg(), listDirsPath, rootDirPath, cfg.Src)
 	sliceFormatString := "\nThen, run the following from the command line in order to divide the workload into smaller chunks:\n" +
-		"\t%s slice -f \"%s\" -p \"%s\" -s [positive--integer-batch-size]\n"
-	fmt.Printf(sliceFormatString, os.Args[0], listFilesPath, rootDirPath)
+		"\t%s slice%s -f \"%s\" -p \"%s\" -s [positive--integer-batch-size]\n"
+	fmt.Printf(sliceFormatString, os.Args[0], nullFlagArg(), listFilesPath, rootDirPath)
 	return nil
 }
 
-func createFilesForList() (dirs, files, errs *os.File, err error) {
+// listFiles are the files written by the ls stage
+type listFiles struct {
+	dirs      *os.File
+	files     *os.File
+	errs      *os.File
+	hardLinks *os.File
+	special   *os.File
+	manifest  *os.File
+	// changes is only created with a baseline manifest
+	changes *os.File
+}
+
+func (l *listFiles) Close() {
+	for _, file := range []*os.File{l.dirs, l.files, l.errs, l.hardLinks, l.special, l.manifest, l.changes} {
+		if file != nil {
+			_ = file.Close()
+		}
+	}
+}
+
+func createFilesForList() (*listFiles, error) {
 	now := time.Now()
+	lists := &listFiles{}
+	var err error
 	listDirsName := fmt.Sprintf(listedDirsFileNamePattern, now.Format(timeDateFormat))
 	listDirsPath = filepath.Join(listDirPath, listDirsName)
-	dirs, err = os.Create(listDirsPath)
-	if err != nil {
-		return nil, nil, nil, err
+	if lists.dirs, err = os.Create(listDirsPath); err != nil {
+		return nil, err
 	}
 	fmt.Println(listDirsPath)
 
 	listFilesName := fmt.Sprintf(listedFilesFileNamePattern, now.Format(timeDateFormat))
 	listFilesPath = filepath.Join(listDirPath, listFilesName)
-	files, err = os.Create(listFilesPath)
-	if err != nil {
-		return nil, nil, nil, err
+	if lists.files, err = os.Create(listFilesPath); err != nil {
+		lists.Close()
+		return nil, err
 	}
 	fmt.Println(listFilesPath)
 
 	errorsFileName := fmt.Sprintf(listErrorsFileNamePattern, now.Format(timeDateFormat))
 	listErrorsPath := filepath.Join(listDirPath, errorsFileName)
-	errs, err = os.Create(listErrorsPath)
-	if err != nil {
-		return nil, nil, nil, err
+	if lists.errs, err = os.Create(listErrorsPath); err != nil {
+		lists.Close()
+		return nil, err
 	}
 	fmt.Println(listErrorsPath)
 
-	return dirs, files, errs, nil
+	hardLinksFileName := fmt.Sprintf(listHardLinksFileNamePattern, now.Format(timeDateFormat))
+	if lists.hardLinks, err = os.Create(filepath.Join(listDirPath, hardLinksFileName)); err != nil {
+		lists.Close()
+		return nil, err
+	}
+
+	specialFileName := fmt.Sprintf(listSpecialFileNamePattern, now.Format(timeDateFormat))
+	if lists.special, err = os.Create(filepath.Join(listDirPath, specialFileName)); err != nil {
+		lists.Close()
+		return nil, err
+	}
+
+	draftFileName := fmt.Sprintf(listManifestFileNamePattern, now.Format(timeDateFormat))
+	if lists.manifest, err = os.Create(filepath.Join(listDirPath, draftFileName)); err != nil {
+		lists.Close()
+		return nil, err
+	}
+
+	if baselineManifest != nil {
+		changesFileName := fmt.Sprintf(listChangesFileNamePattern, now.Format(timeDateFormat))
+		changesPath := filepath.Join(listDirPath, changesFileName)
+		if lists.changes, err = os.Create(changesPath); err != nil {
+			lists.Close()
+			return nil, err
+		}
+		fmt.Println(changesPath)
+	}
+
+	return lists, nil
 }
@@ -11,6 +11,9 @@ import (
 
 func init() {
 	ltCmd.PersistentFlags().StringVarP(&timeString, "time", "t", "", "reference time with format: 20060102T150405")
+	ltCmd.PersistentFlags().StringVar(&sinceLastPath, "since-last", "", sinceLastFlagUsage)
+	ltCmd.PersistentFlags().StringVar(&againstManifestPath, "against-manifest", "", againstManifestFlagUsage)
+	addListFlags(ltCmd)
 	rootCmd.AddCommand(ltCmd)
 }
 
@@ -24,16 +27,7 @@ var ltCmd = &cobra.Command{
 		}
 		cfg.Src = args[0]
 
-		if timeString == "" {
-			return errors.New("time string cannot be empty")
-		}
-		assertedTime, err := parseTime(timeString)
-		if err != nil {
-			return fmt.Errorf("failed to parse time flag value: %v", err)
-		}
-		cfg.ReferenceTime = assertedTime
-
-		return nil
+		return parseReferenceTime()
 	},
 	PreRunE: lsCmd.PreRunE,
 	RunE:    ltRunCmd,
@@ -44,27 +38,31 @@ func ltRunCmd(cmd *cobra.Command, args []string) error {
 	if err := writeOpLog(operationLogLine); err != nil {
 		return err
 	}
+	if err := recordChainParent(); err != nil {
+		return err
+	}
 
 	if err := os.Chdir(listDirPath); err != nil {
 		return err
 	}
 
-	dirs, files, errs, err := createFilesForList()
+	lists, err := createFilesForList()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		_ = dirs.Close()
-		_ = files.Close()
-		_ = errs.Close()
-	}()
+	defer lists.Close()
 
-	in := manager.ServiceInitInput{
-		SourceRootDir: cfg.Src,
+	in, err := listServiceInput()
+	if err != nil {
+		return err
 	}
+	in.HardLinks = lists.hardLinks
+	in.SpecialFiles = lists.special
+	in.Manifest = lists.manifest
+	in.Changes = lists.changes
 
 	service := manager.NewService(in)
-	if err = service.ListSources(dirs, files, errs, cfg.ReferenceTime); err != nil {
+	if err = service.ListSources(lists.dirs, lists.files, lists.errs, cfg.ReferenceTime); err != nil {
 		return err
 	}
 
@@ -74,10 +72,10 @@ func ltRunCmd(cmd *cobra.Command, args []string) error {
 	}
 
 	skeletonFormatString := "Run the following from the command line in order to create directories on the target directory:\n" +
-		"\t%s skeleton -d \"%s\" -p \"%s\" \"%s\" \"[target-dir-path]\"\n"
-	fmt.Printf(skeletonFormatString, os.Args[0], listDirsPath, rootDirPath, cfg.Src)
+		"\t%s skeleton%s -d \"%s\" -p \"%s\" \"%s\" \"[target-dir-path]\"\n"
+	fmt.Printf(skeletonFormatString, os.Args[0], nullFlagArg(), listDirsPath, rootDirPath, cfg.Src)
 	sliceFormatString := "\nThen, run the following from the command line in order to divide the workload into smaller chunks:\n" +
-		"\t%s slice -f \"%s\" -p \"%s\" -s [positive--integer-batch-size]\n"
-	fmt.Printf(sliceFormatString, os.Args[0], listFilesPath, rootDirPath)
+		"\t%s slice%s -f \"%s\" -p \"%s\" -s [positive--integer-batch-size]\n"
+	fmt.Printf(sliceFormatString, os.Args[0], nullFlagArg(), listFilesPath, rootDirPath)
 	return nil
 }
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/AppleGamer22/recursive-backup/internal/manager"
+	"github.com/AppleGamer22/recursive-backup/internal/manifest"
+)
+
+// writeManifest writes the manifest of a completed backup into the project, from the manifest draft of its latest
+// listing and the source checksums of its verified copies. A backup with failed copies is not completed,
+// retry writes its manifest once they succeed.
+func writeManifest() error {
+	failedPaths, err := collectFailedCopies(rootDirPath)
+	if err != nil {
+		return err
+	}
+	if len(failedPaths) > 0 {
+		msg := fmt.Sprintf("manifest not written, %d copies failed", len(failedPaths))
+		fmt.Println(msg)
+		_ = writeOpLog(msg)
+		return nil
+	}
+
+	draftPaths, err := filepath.Glob(filepath.Join(rootDirPath, listDirName, listManifestFileNameGlob))
+	if err != nil {
+		return err
+	}
+	if len(draftPaths) == 0 {
+		return fmt.Errorf("no manifest draft found in project %s", rootDirPath)
+	}
+	sort.Strings(draftPaths)
+	m, err := readManifestFile(draftPaths[len(draftPaths)-1])
+	if err != nil {
+		return err
+	}
+	checksums, err := addCopyChecksums(m)
+	if err != nil {
+		return err
+	}
+
+	manifestPath := filepath.Join(rootDirPath, manifestFileName)
+	file, err := os.Create(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %w", err)
+	}
+	err = m.Save(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	fmt.Println(manifestPath)
+	_ = writeOpLog(fmt.Sprintf("manifest written: %s, %d entries, %d checksums", manifestPath, m.Len(), checksums))
+	return nil
+}
+
+// addCopyChecksums adds the source checksums of the verified copies of the project to the entries of m,
+// the last copy of a file wins. It returns the number of entries holding a checksum.
+func addCopyChecksums(m *manifest.Manifest) (int, error) {
+	logPaths, err := projectCopyLogPaths(rootDirPath)
+	if err != nil {
+		return 0, err
+	}
+	for _, logPath := range logPaths {
+		entries, err := readCopyLogFile(logPath)
+		if err != nil {
+			_ = writeOpLog(fmt.Sprintf("failed to read copy log %s (%v)", logPath, err))
+			continue
+		}
+		for _, copied := range entries {
+			if copied.Status == manager.CopyStatusFailure || len(copied.SourceChecksum) == 0 {
+				continue
+			}
+			relPath, err := filepath.Rel(cfg.Src, copied.SourcePath)
+			if err != nil {
+				continue
+			}
+			if entry, ok := m.Get(relPath); ok {
+				entry.ChecksumAlgorithm, entry.Checksum = copied.ChecksumAlgorithm, copied.SourceChecksum
+				m.Add(entry)
+			}
+		}
+	}
+	var checksums int
+	for _, entry := range m.Entries() {
+		if len(entry.Checksum) > 0 {
+			checksums++
+		}
+	}
+	return checksums, nil
+}
+
+// resolveManifestPath returns the manifest at path, or the one in the project dir at path
+func resolveManifestPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		path = filepath.Join(path, manifestFileName)
+	}
+	return path, nil
+}
+
+func readManifestFile(path string) (*manifest.Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	m, err := manifest.Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+	"github.com/spf13/cobra"
+)
+
+var deletePolicy string
+
+func init() {
+	// ls dependency
+	addListFlags(mirrorCmd)
+
+	// slice dependency
+	mirrorCmd.Flags().UintVarP(&batchSize, "batch-size", "s", defaultBatchSize, "maximum number of files in a batch")
+
+	// cp dependency
+	addCopyFlags(mirrorCmd)
+
+	mirrorCmd.Flags().StringVar(&deletePolicy, "delete", tasks.DeleteReport, deleteFlagUsage)
+	rootCmd.AddCommand(mirrorCmd)
+}
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror [source-dir-path] [target-dir-path]",
+	Short: "mirror backup",
+	Long: "with mirror backup all files and folders are copied from src to target, " +
+		"then the target files and folders whose source was deleted are reported, moved to the trash or removed",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := fullCmd.Args(cmd, args); err != nil {
+			return err
+		}
+		return tasks.ValidateDeletePolicy(deletePolicy)
+	},
+	PreRunE: fullCmd.PreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := fullCmd.RunE(cmd, args); err != nil {
+			return err
+		}
+		return mirrorDeletions()
+	},
+}
+
+// mirrorDeletions compares the target with the lists of the ls stage and handles the entries whose source was deleted
+func mirrorDeletions() error {
+	timeStamp := time.Now().Format(timeDateFormat)
+	trashDir := filepath.Join(cfg.Target, tasks.TrashDirName, timeStamp)
+	_ = writeOpLog(fmt.Sprintf("mirror deletions start (policy: %s)", deletePolicy))
+
+	dirsList, err := os.Open(listDirsPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dirsList.Close()
+	}()
+	filesList, err := os.Open(listFilesPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = filesList.Close()
+	}()
+	deletionsPath := filepath.Join(rootDirPath, listDirName, fmt.Sprintf(listDeletionsFileNamePattern, timeStamp))
+	deletions, err := os.Create(deletionsPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = deletions.Close()
+	}()
+	fmt.Println(deletionsPath)
+
+	ctx, stopSignalHandling := newSignalContext()
+	defer stopSignalHandling()
+	result, err := service.HandleTargetDeletionsContext(ctx, dirsList, filesList, deletions, deletePolicy, trashDir)
+	msg := fmt.Sprintf("mirror deletions: %d target entries with a deleted source (%s), %d failed, %d unlisted kept since their source exists",
+		result.Deleted, deletePolicy, result.Failed, result.Kept)
+	if deletePolicy == tasks.DeleteTrash && result.Deleted > result.Failed {
+		msg += fmt.Sprintf(", trash %s", trashDir)
+	}
+	fmt.Println(msg)
+	_ = writeOpLog(msg)
+	return err
+}
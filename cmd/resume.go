@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/AppleGamer22/recursive-backup/internal/listfile"
+	"github.com/AppleGamer22/recursive-backup/internal/manager"
+)
+
+// findLatestBatchesDir returns the project's most recent batches dir, relying on its time stamped name
+func findLatestBatchesDir() (string, error) {
+	pattern := filepath.Join(rootDirPath, fmt.Sprintf(sliceBatchesDirNamePattern, "*"))
+	batchesDirPaths, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(batchesDirPaths) == 0 {
+		return "", fmt.Errorf("no batches dir found in project %s", rootDirPath)
+	}
+	sort.Strings(batchesDirPaths)
+	return batchesDirPaths[len(batchesDirPaths)-1], nil
+}
+
+// findResumableCopyLog returns the latest copy log of the batch written between the slicing of its batches dir
+// and the slicing of the next one, along with the source paths it already records as copied.
+// An empty path means the batch was never started.
+func findResumableCopyLog(batchID uint) (string, map[string]bool, error) {
+	batchesTimeStamp := strings.TrimPrefix(filepath.Base(batchesDirPath), "batches_")
+	nextBatchesTimeStamp, err := findNextBatchesTimeStamp(batchesTimeStamp)
+	if err != nil {
+		return "", nil, err
+	}
+	pattern := filepath.Join(rootDirPath, fmt.Sprintf(copyLogDirPattern, "*"), fmt.Sprintf(copyBatchLogFileNamePattern, batchID))
+	logPaths, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", nil, err
+	}
+	sort.Strings(logPaths)
+
+	var resumableLogPath string
+	succeeded := make(map[string]bool)
+	for _, logPath := range logPaths {
+		logTimeStamp := strings.TrimPrefix(filepath.Base(filepath.Dir(logPath)), "copy_logs_")
+		if logTimeStamp < batchesTimeStamp || (len(nextBatchesTimeStamp) > 0 && logTimeStamp >= nextBatchesTimeStamp) {
+			continue
+		}
+		// a log cut short by the interruption is still used up to its last complete row
+		entries, err := readCopyLogFile(logPath)
+		if err != nil && len(entries) == 0 {
+			_ = writeOpLog(fmt.Sprintf("failed to read copy log %s (%v)", logPath, err))
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Status == manager.CopyStatusSuccess || entry.Status == manager.CopyStatusSkipped {
+				succeeded[entry.SourcePath] = true
+			}
+		}
+		resumableLogPath = logPath
+	}
+	return resumableLogPath, succeeded, nil
+}
+
+// findNextBatchesTimeStamp returns the time stamp of the first batches dir sliced after the given one, if any
+func findNextBatchesTimeStamp(batchesTimeStamp string) (string, error) {
+	pattern := filepath.Join(rootDirPath, fmt.Sprintf(sliceBatchesDirNamePattern, "*"))
+	batchesDirPaths, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(batchesDirPaths)
+	for _, path := range batchesDirPaths {
+		if timeStamp := strings.TrimPrefix(filepath.Base(path), "batches_"); timeStamp > batchesTimeStamp {
+			return timeStamp, nil
+		}
+	}
+	return "", nil
+}
+
+// filterCopiedFiles returns the batch files list without the already copied source paths
+func filterCopiedFiles(filesList io.Reader, succeeded map[string]bool) (io.Reader, error) {
+	builder := strings.Builder{}
+	reader := listfile.NewReader(filesList)
+	var writer *listfile.Writer
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("files list reader failed. Error:  %v", err)
+		}
+		if writer == nil {
+			if writer, err = listfile.NewWriter(&builder, reader.Format()); err != nil {
+				return nil, err
+			}
+		}
+		if succeeded[record.Path] {
+			continue
+		}
+		if err = writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	if writer != nil {
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return strings.NewReader(builder.String()), nil
+}
+
+// openCopyLogForAppend opens an existing copy log for appending, terminating a row torn by the interruption first
+func openCopyLogForAppend(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open copy log file. Error: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if info.Size() > 0 {
+		lastByte := make([]byte, 1)
+		if _, err = file.ReadAt(lastByte, info.Size()-1); err != nil && !errors.Is(err, io.EOF) {
+			_ = file.Close()
+			return nil, err
+		}
+		if lastByte[0] != LineBreak {
+			_, _ = file.Write([]byte{LineBreak})
+		}
+	}
+	return file, nil
+}
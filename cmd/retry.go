@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/listfile"
+	"github.com/AppleGamer22/recursive-backup/internal/manager"
+	"github.com/spf13/cobra"
+)
+
+var retryRounds uint
+var retryRoundDelay time.Duration
+
+func init() {
+	retryCmd.Flags().StringVarP(&rootDirPath, "project", "p", "", "mandatory flag: project root path")
+	retryCmd.Flags().UintVarP(&retryRounds, "rounds", "r", 3, "maximum number of retry rounds")
+	retryCmd.Flags().DurationVar(&retryRoundDelay, "round-delay", 10*time.Second, "delay between retry rounds (at least 1s)")
+
+	// slice dependency
+	retryCmd.Flags().UintVarP(&batchSize, "batch-size", "s", defaultBatchSize, "maximum number of files in a batch")
+
+	// cp dependency
+	addCopyFlags(retryCmd)
+	addSymlinksFlag(retryCmd)
+	addSpecialFlag(retryCmd)
+
+	rootCmd.AddCommand(retryCmd)
+}
+
+var retryCmd = &cobra.Command{
+	Use:   "retry [source-dir-path] [target-dir-path]",
+	Short: "retry failed copies",
+	Long:  "retry the files whose last copy attempt in the project failed, by slicing them into new batches and copying them again",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("arguments mismatch, expecting 2 arguments: [source-dir-path] [target-dir-path]")
+		}
+		cfg.Src = args[0]
+		cfg.Target = args[1]
+		return nil
+	},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(rootDirPath) == 0 {
+			return errors.New("project root path flag must be specified")
+		}
+		if retryRoundDelay < time.Second {
+			return errors.New("round-delay must be at least 1s, since project file names have a one second resolution")
+		}
+		var err error
+		if rootDirPath, err = filepath.Abs(rootDirPath); err != nil {
+			return fmt.Errorf("failed to create absolute path for project dir: %v", err)
+		}
+		return nil
+	},
+	RunE: retryRunCommand,
+}
+
+func retryRunCommand(cmd *cobra.Command, args []string) error {
+	for round := uint(1); round <= retryRounds; round++ {
+		failedPaths, err := collectFailedCopies(rootDirPath)
+		if err != nil {
+			return err
+		}
+		if len(failedPaths) == 0 {
+			fmt.Println("no failed copies left to retry")
+			_ = writeOpLog("retry finished with no failed copies left")
+			return retryComplete()
+		}
+		if round > 1 {
+			time.Sleep(retryRoundDelay)
+		}
+		_ = writeOpLog(fmt.Sprintf("retry round %d start for %d failed copies", round, len(failedPaths)))
+
+		// slice
+		if filesListFilePath, err = writeRetryFilesList(failedPaths); err != nil {
+			return err
+		}
+		if err = sliceCmd.PreRunE(cmd, args); err != nil {
+			return err
+		}
+		if err = sliceCmd.RunE(cmd, args); err != nil {
+			return err
+		}
+
+		// cp
+		batchesDirPath = batchesSourceDirPath
+		if err = cpCmd.PreRunE(cmd, args); err != nil {
+			return err
+		}
+		if err = cpCmd.RunE(cmd, args); err != nil {
+			return err
+		}
+		_ = writeOpLog(fmt.Sprintf("retry round %d end", round))
+	}
+
+	failedPaths, err := collectFailedCopies(rootDirPath)
+	if err != nil {
+		return err
+	}
+	_ = writeOpLog(fmt.Sprintf("retry finished with %d failed copies left", len(failedPaths)))
+	if len(failedPaths) > 0 {
+		return fmt.Errorf("%d copies still failed after %d retry rounds", len(failedPaths), retryRounds)
+	}
+	return retryComplete()
+}
+
+// retryComplete completes the backup of a project with no failed copies left: it writes the manifest the backup
+// left out, and names a partial snapshot target after its start time
+func retryComplete() error {
+	if err := retryWriteManifest(); err != nil {
+		return err
+	}
+	partialDir, err := filepath.Abs(cfg.Target)
+	if err != nil {
+		return err
+	}
+	if snapshotDir, ok := partialSnapshotDir(partialDir); ok {
+		return completeSnapshot(partialDir, snapshotDir)
+	}
+	return nil
+}
+
+// retryWriteManifest writes the manifest a backup left out due to its failed copies.
+// Projects listed before manifests were written have no manifest draft and keep none.
+func retryWriteManifest() error {
+	if _, err := os.Stat(filepath.Join(rootDirPath, manifestFileName)); err == nil {
+		return nil
+	}
+	if err := writeManifest(); err != nil {
+		_ = writeOpLog(fmt.Sprintf("retry wrote no manifest (%v)", err))
+		fmt.Printf("no manifest written: %v\n", err)
+	}
+	return nil
+}
+
+// collectFailedCopies returns the sorted source paths whose last row in the copy logs of the project at projectPath is a failure.
+// Copy log dirs are named by their creation time, so their lexical order is the order of the attempts.
+func collectFailedCopies(projectPath string) ([]string, error) {
+	logPaths, err := projectCopyLogPaths(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lastStatus := make(map[string]string)
+	for _, logPath := range logPaths {
+		entries, err := readCopyLogFile(logPath)
+		if err != nil {
+			_ = writeOpLog(fmt.Sprintf("failed to read copy log %s (%v)", logPath, err))
+			continue
+		}
+		for _, entry := range entries {
+			lastStatus[entry.SourcePath] = entry.Status
+		}
+	}
+
+	var failedPaths []string
+	for path, status := range lastStatus {
+		if status == manager.CopyStatusFailure {
+			failedPaths = append(failedPaths, path)
+		}
+	}
+	sort.Strings(failedPaths)
+	return failedPaths, nil
+}
+
+// projectCopyLogPaths returns the copy logs of the project at projectPath, in the order of their attempts
+func projectCopyLogPaths(projectPath string) ([]string, error) {
+	return filepath.Glob(filepath.Join(projectPath, fmt.Sprintf(copyLogDirPattern, "*"), copyBatchLogFileNameGlob))
+}
+
+func readCopyLogFile(path string) ([]manager.CopyLogEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return manager.ReadCopyLog(file)
+}
+
+func writeRetryFilesList(paths []string) (string, error) {
+	listFileName := fmt.Sprintf(retryFilesFileNamePattern, time.Now().Format(timeDateFormat))
+	listFilePath := filepath.Join(rootDirPath, listDirName, listFileName)
+	file, err := os.Create(listFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create retry files list. %s", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	// a path with a line break only survives in a NUL terminated list, which slice detects
+	format := listfile.FormatPlain
+	for _, path := range paths {
+		if strings.ContainsAny(path, "\n\r") {
+			format = listfile.FormatNull
+			break
+		}
+	}
+	writer := bufio.NewWriter(file)
+	filesList, err := listfile.NewWriter(writer, format)
+	if err != nil {
+		return "", err
+	}
+	for _, path := range paths {
+		_ = filesList.Write(listfile.Record{Path: path})
+	}
+	if err = writer.Flush(); err != nil {
+		return "", err
+	}
+	fmt.Println(listFilePath)
+	return listFilePath, nil
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// newSignalContext returns a context cancelled by the first SIGINT or SIGTERM, so in-flight copies are rolled back
+// and logs flush. A second signal exits immediately. The returned func stops the signal handling.
+func newSignalContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Printf("\nreceived %s, rolling back in-flight copies and flushing logs. Send it again to exit immediately\n", sig)
+			_ = writeOpLog(fmt.Sprintf("cp interrupted by signal %s", sig))
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-signals:
+			_ = writeOpLog(fmt.Sprintf("cp forced exit by signal %s", sig))
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/AppleGamer22/recursive-backup/internal/manager"
 	"github.com/AppleGamer22/recursive-backup/internal/rberrors"
+	"github.com/AppleGamer22/recursive-backup/internal/tasks"
 	"github.com/spf13/cobra"
 )
 
@@ -21,6 +22,8 @@ func init() {
 	skeletonCmd.Flags().StringVarP(&rootDirPath, "project", "p", "", "mandatory flag: project root path")
 	skeletonCmd.Flags().StringVarP(&dirsListFilePath, "dirs-list-file-path", "d", "", "mandatory flag: directories list file path")
 	skeletonCmd.Flags().StringVarP(&validationMode, "dir-validation-mode", "v", rberrors.Report, "validation mode for directories short list (none, report, block)")
+	addNullFlag(skeletonCmd)
+	addSymlinksFlag(skeletonCmd)
 	rootCmd.AddCommand(skeletonCmd)
 
 }
@@ -33,6 +36,9 @@ var skeletonCmd = &cobra.Command{
 		if validationMode != rberrors.None && validationMode != rberrors.Report && validationMode != rberrors.Block {
 			return fmt.Errorf("--on-missing-dir flag can be on of none, report or block, got %s", validationMode)
 		}
+		if err := tasks.ValidateSymlinks(symlinkPolicy); err != nil {
+			return err
+		}
 
 		if len(args) != 2 {
 			return errors.New("arguments mismatch, expecting 2 arguments: [source-dir-path] [target-dir-path]")
@@ -72,6 +78,8 @@ func skeletonRunCommand(cmd *cobra.Command, args []string) error {
 	in := manager.ServiceInitInput{
 		SourceRootDir: cfg.Src,
 		TargetRootDir: cfg.Target,
+		NullDelimited: nullDelimited,
+		Symlinks:      symlinkPolicy,
 	}
 	service := manager.NewService(in)
 	var reader io.Reader
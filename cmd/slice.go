@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/AppleGamer22/recursive-backup/internal/listfile"
 	"github.com/spf13/cobra"
 )
 
@@ -27,6 +28,7 @@ func init() {
 	sliceCmd.Flags().StringVarP(&rootDirPath, "project", "p", "", "mandatory flag: project root path")
 	sliceCmd.Flags().StringVarP(&filesListFilePath, "files-list-file-path", "f", "", "mandatory flag: files list file path")
 	sliceCmd.Flags().UintVarP(&batchSize, "batch-size", "s", defaultBatchSize, "maximum number of files in a batch")
+	addNullFlag(sliceCmd)
 	rootCmd.AddCommand(sliceCmd)
 }
 
@@ -98,15 +100,17 @@ func sliceRunCommand(_ *cobra.Command, _ []string) error {
 	}
 
 	helpFormat := "\nRun the following from the command line in order to copy the files:\n" +
-		"\t%s cp -b \"%s\" -p \"%s\" -q 200 [source-dir-path] [target-dir-path]\n"
-	fmt.Printf(helpFormat, os.Args[0], batchesSourceDirPath, rootDirPath)
+		"\t%s cp%s -b \"%s\" -p \"%s\" -q 200 [source-dir-path] [target-dir-path]\n"
+	fmt.Printf(helpFormat, os.Args[0], nullFlagArg(), batchesSourceDirPath, rootDirPath)
 	return nil
 }
 
+// sliceFileCopyBatches writes the files list into batch files of batchSize records, in the format of the files list
 func sliceFileCopyBatches(inFilesListFile *os.File, errorsFile *os.File) error {
-	var batchCounter, lineCounter uint
+	var batchCounter, recordCounter uint
 	var batchFile *os.File
 	var writer *bufio.Writer
+	var batchWriter *listfile.Writer
 	var err error
 	fileCount, seekZeroFunc, err := countFiles(inFilesListFile)
 	if err != nil {
@@ -121,14 +125,31 @@ func sliceFileCopyBatches(inFilesListFile *os.File, errorsFile *os.File) error {
 	if fileCount >= 1 {
 		numDigits = uint(math.Ceil(math.Log10(batchCount)))
 	}
-	scanner := bufio.NewScanner(inFilesListFile)
-	for scanner.Scan() {
-		if lineCounter == 0 {
+	closeBatch := func() {
+		if batchFile == nil {
+			return
+		}
+		_ = batchWriter.Flush()
+		_ = writer.Flush()
+		_ = batchFile.Close()
+		batchFile = nil
+	}
+	reader, err := newFilesListReader(inFilesListFile)
+	if err != nil {
+		return err
+	}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			closeBatch()
+			return fmt.Errorf("files list reader failed. Error:  %v", err)
+		}
+		if recordCounter == 0 {
 			batchCounter++
-			if batchCounter > 1 {
-				_ = writer.Flush()
-				_ = batchFile.Close()
-			}
+			closeBatch()
 			numBatchDigits := uint(math.Ceil(math.Log10(float64(batchCounter))))
 			zeroPadding := strings.Repeat("0", int(numDigits-numBatchDigits))
 			batchFileName := fmt.Sprintf(sliceBatchFileNamePattern, zeroPadding, batchCounter)
@@ -137,27 +158,29 @@ func sliceFileCopyBatches(inFilesListFile *os.File, errorsFile *os.File) error {
 			if err != nil {
 				_, _ = fmt.Fprintf(errorsFile, "failed to create batch file. batch_number: %d\n", batchCounter)
 				fmt.Println("failed to create batch file. batch_number:", batchCounter)
-				lineCounter = (lineCounter + 1) % batchSize
+				recordCounter = (recordCounter + 1) % batchSize
 				continue
 			}
 			fmt.Println(batchFilePath)
 			writer = bufio.NewWriter(batchFile)
+			if batchWriter, err = listfile.NewWriter(writer, reader.Format()); err != nil {
+				return err
+			}
 		}
 
-		line := scanner.Text()
-		if _, err = fmt.Fprintln(writer, line); err != nil {
-			_, _ = fmt.Fprintf(errorsFile, "failed to write line. line: %s, error: %s\n", line, err.Error())
-			lineCounter = (lineCounter + 1) % batchSize
+		if batchFile == nil {
+			recordCounter = (recordCounter + 1) % batchSize
+			continue
+		}
+		if err = batchWriter.Write(record); err != nil {
+			_, _ = fmt.Fprintf(errorsFile, "failed to write line. line: %s, error: %s\n", record.Path, err.Error())
+			recordCounter = (recordCounter + 1) % batchSize
 			continue
 		}
 
-		lineCounter = (lineCounter + 1) % batchSize
-	}
-	_ = writer.Flush()
-	_ = batchFile.Close()
-	if err = scanner.Err(); err != nil {
-		return fmt.Errorf("files list scanner failed. Error:  %v", err)
+		recordCounter = (recordCounter + 1) % batchSize
 	}
+	closeBatch()
 	return nil
 }
 
@@ -185,9 +208,26 @@ func countFiles(file *os.File) (uint, func() error, error) {
 		}
 		return nil
 	}
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
+	reader, err := newFilesListReader(file)
+	if err != nil {
+		return 0, seekZeroFunc, err
+	}
+	for {
+		_, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return output, seekZeroFunc, nil
+		}
+		if err != nil {
+			return output, seekZeroFunc, err
+		}
 		output++
 	}
-	return output, seekZeroFunc, scanner.Err()
+}
+
+// newFilesListReader reads a NUL terminated files list with the null flag and detects the list format otherwise
+func newFilesListReader(r io.Reader) (*listfile.Reader, error) {
+	if nullDelimited {
+		return listfile.NewReaderFormat(r, listfile.FormatNull)
+	}
+	return listfile.NewReader(r), nil
 }
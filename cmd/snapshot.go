@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	// ls dependency
+	addListFlags(snapshotCmd)
+
+	// slice dependency
+	snapshotCmd.Flags().UintVarP(&batchSize, "batch-size", "s", defaultBatchSize, "maximum number of files in a batch")
+
+	// cp dependency
+	addCopyFlags(snapshotCmd)
+
+	rootCmd.AddCommand(snapshotCmd)
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot [source-dir-path] [target-dir-path]",
+	Short: "snapshot backup",
+	Long: "with snapshot backup every run backs up src into a new time stamped dir of target, " +
+		"hard linking the files unchanged since the previous snapshot to their copy in it, " +
+		"so every snapshot is a full backup that only takes the space of the changed files",
+	Args:    fullCmd.Args,
+	PreRunE: fullCmd.PreRunE,
+	RunE:    snapshotRunCommand,
+}
+
+// snapshotRunCommand runs a full backup into a partial snapshot dir, linking the unchanged files to the latest complete
+// snapshot, and names it after its start time once all of its copies succeeded
+func snapshotRunCommand(cmd *cobra.Command, args []string) error {
+	snapshotsDir, err := filepath.Abs(cfg.Target)
+	if err != nil {
+		return err
+	}
+	previous, err := findLatestSnapshot(snapshotsDir)
+	if err != nil {
+		return err
+	}
+	snapshotDir := filepath.Join(snapshotsDir, time.Now().Format(timeDateFormat))
+	partialDir := snapshotDir + tasks.PartialFileSuffix
+	if err = os.Mkdir(partialDir, defaultPerm); err != nil {
+		return fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+	fmt.Println(partialDir)
+	if len(previous) > 0 {
+		_ = writeOpLog(fmt.Sprintf("snapshot start: %s, linking unchanged files to %s", partialDir, previous))
+	} else {
+		_ = writeOpLog(fmt.Sprintf("snapshot start: %s, no previous snapshot", partialDir))
+	}
+
+	cfg.Target = partialDir
+	linkDestPath = previous
+	if err = fullCmd.RunE(cmd, args); err != nil {
+		return err
+	}
+
+	failedPaths, err := collectFailedCopies(rootDirPath)
+	if err != nil {
+		return err
+	}
+	if len(failedPaths) > 0 {
+		msg := fmt.Sprintf("snapshot incomplete: %d copies failed, kept at %s", len(failedPaths), partialDir)
+		_ = writeOpLog(msg)
+		return fmt.Errorf("%s, run retry on the project with it as target to complete it as %s", msg, snapshotDir)
+	}
+	return completeSnapshot(partialDir, snapshotDir)
+}
+
+// completeSnapshot names the partial snapshot dir after its start time, once all of its copies succeeded
+func completeSnapshot(partialDir, snapshotDir string) error {
+	if err := os.Rename(partialDir, snapshotDir); err != nil {
+		return fmt.Errorf("failed to complete snapshot: %w", err)
+	}
+	fmt.Println(snapshotDir)
+	_ = writeOpLog(fmt.Sprintf("snapshot finished: %s", snapshotDir))
+	return nil
+}
+
+// partialSnapshotDir returns the complete snapshot dir of a partial snapshot dir, or false for any other dir
+func partialSnapshotDir(dir string) (string, bool) {
+	snapshotDir := strings.TrimSuffix(filepath.Clean(dir), tasks.PartialFileSuffix)
+	if snapshotDir == filepath.Clean(dir) || !regexp.MustCompile(snapshotDirRegexp).MatchString(filepath.Base(snapshotDir)) {
+		return "", false
+	}
+	return snapshotDir, true
+}
+
+// findLatestSnapshot returns the latest complete snapshot in snapshotsDir, or an empty path when there is none.
+// Partial snapshots are skipped, their name carries the partial suffix.
+func findLatestSnapshot(snapshotsDir string) (string, error) {
+	entries, err := os.ReadDir(snapshotsDir)
+	if err != nil {
+		return "", err
+	}
+	re := regexp.MustCompile(snapshotDirRegexp)
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && re.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+	return filepath.Join(snapshotsDir, names[len(names)-1]), nil
+}
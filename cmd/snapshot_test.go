@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindLatestSnapshot(t *testing.T) {
+	testCases := []struct {
+		title    string
+		dirs     []string
+		files    []string
+		expected string
+	}{
+		{title: "no snapshots"},
+		{
+			title:    "latest complete snapshot",
+			dirs:     []string{"20220101T120000", "20220301T120000", "20220201T120000"},
+			expected: "20220301T120000",
+		},
+		{
+			title:    "partial and foreign dirs are skipped",
+			dirs:     []string{"20220101T120000", "20220301T120000" + tasks.PartialFileSuffix, "latest", "20220401"},
+			expected: "20220101T120000",
+		},
+		{
+			title: "files are skipped",
+			files: []string{"20220101T120000"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			// given
+			snapshotsPath, err := os.MkdirTemp("", "snapshots_*")
+			require.NoError(t, err)
+			for _, dir := range tc.dirs {
+				require.NoError(t, os.Mkdir(filepath.Join(snapshotsPath, dir), 0755))
+			}
+			for _, file := range tc.files {
+				require.NoError(t, os.WriteFile(filepath.Join(snapshotsPath, file), nil, 0644))
+			}
+
+			// when
+			actual, err := findLatestSnapshot(snapshotsPath)
+
+			// then
+			require.NoError(t, err)
+			if len(tc.expected) == 0 {
+				assert.Empty(t, actual)
+				return
+			}
+			assert.Equal(t, filepath.Join(snapshotsPath, tc.expected), actual)
+		})
+	}
+}
+
+func TestPartialSnapshotDir(t *testing.T) {
+	snapshotsPath := filepath.Join("backups", "snapshots")
+
+	actual, ok := partialSnapshotDir(filepath.Join(snapshotsPath, "20220301T120000"+tasks.PartialFileSuffix))
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(snapshotsPath, "20220301T120000"), actual)
+
+	for _, dir := range []string{"20220301T120000", "latest" + tasks.PartialFileSuffix, "20220301" + tasks.PartialFileSuffix} {
+		_, ok = partialSnapshotDir(filepath.Join(snapshotsPath, dir))
+		assert.False(t, ok, dir)
+	}
+}
+
+func TestCompleteSnapshot(t *testing.T) {
+	// given
+	projectPath, err := os.MkdirTemp("", "project_*")
+	require.NoError(t, err)
+	defer func(previous string) {
+		rootDirPath = previous
+	}(rootDirPath)
+	rootDirPath = projectPath
+	snapshotsPath, err := os.MkdirTemp("", "snapshots_*")
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(filepath.Join(snapshotsPath, "20220201T120000"), 0755))
+	partialDir := filepath.Join(snapshotsPath, "20220301T120000"+tasks.PartialFileSuffix)
+	require.NoError(t, os.Mkdir(partialDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(partialDir, "file.txt"), []byte("data"), 0644))
+	snapshotDir, ok := partialSnapshotDir(partialDir)
+	require.True(t, ok)
+
+	// when
+	err = completeSnapshot(partialDir, snapshotDir)
+
+	// then
+	require.NoError(t, err)
+	assert.NoDirExists(t, partialDir)
+	data, err := os.ReadFile(filepath.Join(snapshotDir, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	latest, err := findLatestSnapshot(snapshotsPath)
+	require.NoError(t, err)
+	assert.Equal(t, snapshotDir, latest, "the completed snapshot is the next link-dest")
+	opLog, err := os.ReadFile(filepath.Join(projectPath, operationLogFileName))
+	require.NoError(t, err)
+	assert.Contains(t, string(opLog), "snapshot finished: "+snapshotDir)
+}
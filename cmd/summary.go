@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+	"github.com/AppleGamer22/recursive-backup/internal/throttle"
+	"github.com/AppleGamer22/recursive-backup/internal/utils"
+)
+
+// copySummary counts the responses of a cp run for the summary written when it ends
+type copySummary struct {
+	start   time.Time
+	limiter *throttle.Limiter
+	copied  uint64
+	linked  uint64
+	hard    uint64
+	reused  uint64
+	special uint64
+	skipped uint64
+	// skippedLinks are the sources found to be symlinks with the skip policy
+	skippedLinks uint64
+	failed       uint64
+	bytes        uint64
+}
+
+func newCopySummary(limiter *throttle.Limiter) *copySummary {
+	return &copySummary{start: time.Now(), limiter: limiter}
+}
+
+func (s *copySummary) observe(response tasks.BackupFileResponse) {
+	if !response.CompletionStatus {
+		atomic.AddUint64(&s.failed, 1)
+		return
+	}
+	if response.Skipped && response.Action == tasks.ActionSymlink {
+		atomic.AddUint64(&s.skippedLinks, 1)
+		return
+	}
+	if response.Skipped {
+		atomic.AddUint64(&s.skipped, 1)
+		return
+	}
+	if response.Action == tasks.ActionSymlink {
+		atomic.AddUint64(&s.linked, 1)
+		return
+	}
+	if response.Action == tasks.ActionHardLink {
+		atomic.AddUint64(&s.hard, 1)
+		return
+	}
+	if response.Action == tasks.ActionLinkDest {
+		atomic.AddUint64(&s.reused, 1)
+		return
+	}
+	if response.Action == tasks.ActionSpecial {
+		atomic.AddUint64(&s.special, 1)
+		return
+	}
+	atomic.AddUint64(&s.copied, 1)
+	atomic.AddUint64(&s.bytes, uint64(response.BytesCopied))
+}
+
+func (s *copySummary) String() string {
+	elapsed := time.Since(s.start)
+	bytes := atomic.LoadUint64(&s.bytes)
+	var rate int64
+	if elapsed > 0 {
+		rate = int64(float64(bytes) / elapsed.Seconds())
+	}
+	limit := "unlimited"
+	if s.limiter != nil {
+		limit = s.limiter.String()
+	}
+	links := ""
+	if linked := atomic.LoadUint64(&s.linked); linked > 0 {
+		links = fmt.Sprintf(", %d symlinks recreated", linked)
+	}
+	if hard := atomic.LoadUint64(&s.hard); hard > 0 {
+		links += fmt.Sprintf(", %d hard links recreated", hard)
+	}
+	if reused := atomic.LoadUint64(&s.reused); reused > 0 {
+		links += fmt.Sprintf(", %d unchanged linked to the previous backup", reused)
+	}
+	if special := atomic.LoadUint64(&s.special); special > 0 {
+		links += fmt.Sprintf(", %d special files recreated", special)
+	}
+	if skipped := atomic.LoadUint64(&s.skipped); skipped > 0 {
+		links += fmt.Sprintf(", %d unchanged skipped", skipped)
+	}
+	if skippedLinks := atomic.LoadUint64(&s.skippedLinks); skippedLinks > 0 {
+		links += fmt.Sprintf(", %d symlinks skipped", skippedLinks)
+	}
+	return fmt.Sprintf("cp summary: %d files copied%s, %d failed, %s in %s (%s/s effective, bandwidth limit: %s)",
+		atomic.LoadUint64(&s.copied), links, atomic.LoadUint64(&s.failed), utils.FormatByteSize(int64(bytes)),
+		elapsed.Round(time.Millisecond), utils.FormatByteSize(rate), limit)
+}
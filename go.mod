@@ -3,7 +3,9 @@ module github.com/AppleGamer22/recursive-backup
 go 1.16
 
 require (
+	github.com/cespare/xxhash/v2 v2.1.2
 	github.com/go-ozzo/ozzo-validation/v4 v4.3.0
 	github.com/spf13/cobra v1.2.1
 	github.com/stretchr/testify v1.7.0
+	lukechampine.com/blake3 v1.1.7
 )
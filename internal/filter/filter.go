@@ -0,0 +1,165 @@
+package filter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultIgnoreFileName is the per directory rules file honored by the source lister
+const DefaultIgnoreFileName = ".rbignore"
+
+// Options holds the rules of a Filter. The rules are evaluated in order, the last matching rule wins:
+// the ignore files from the root down to the entry's directory, then Excludes, then Includes.
+type Options struct {
+	Excludes []string
+	Includes []string
+	// IgnoreFileName is read in every directory the filter loads, empty disables ignore files
+	IgnoreFileName string
+}
+
+// Filter decides which entries under its root are excluded. It is safe for concurrent use.
+type Filter struct {
+	root           string
+	ignoreFileName string
+	flagRules      []*rule
+	mu             sync.RWMutex
+	dirRules       map[string][]*rule
+}
+
+func New(root string, opts Options) (*Filter, error) {
+	f := &Filter{
+		root:           root,
+		ignoreFileName: opts.IgnoreFileName,
+		dirRules:       make(map[string][]*rule),
+	}
+	for _, pattern := range opts.Excludes {
+		if err := f.addFlagRule(pattern, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range opts.Includes {
+		if err := f.addFlagRule(pattern, true); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *Filter) addFlagRule(pattern string, include bool) error {
+	r, err := parseRule(pattern, "", include)
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		f.flagRules = append(f.flagRules, r)
+	}
+	return nil
+}
+
+// LoadDir reads the ignore file of dir, if any, so its rules apply to the entries below dir.
+// It is called for every directory before its entries are matched.
+func (f *Filter) LoadDir(dir string) error {
+	if len(f.ignoreFileName) == 0 {
+		return nil
+	}
+	rel, err := f.rel(dir)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Join(dir, f.ignoreFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var rules []*rule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		r, err := parseRule(scanner.Text(), rel, false)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file.Name(), err)
+		}
+		if r != nil {
+			rules = append(rules, r)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.dirRules[rel] = rules
+	f.mu.Unlock()
+	return nil
+}
+
+// Excluded reports whether path, a path under the filter root, is excluded. The root itself is never excluded.
+func (f *Filter) Excluded(path string, isDir bool) bool {
+	rel, err := f.rel(path)
+	if err != nil || len(rel) == 0 {
+		return false
+	}
+	excluded := false
+	for _, r := range f.rulesFor(rel) {
+		if r.matches(rel, isDir) {
+			excluded = !r.Include
+		}
+	}
+	return excluded
+}
+
+// rulesFor returns the ignore file rules of the ancestors of rel, outermost first, followed by the flag rules
+func (f *Filter) rulesFor(rel string) []*rule {
+	var rules []*rule
+	f.mu.RLock()
+	rules = append(rules, f.dirRules[""]...)
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' {
+			rules = append(rules, f.dirRules[rel[:i]]...)
+		}
+	}
+	f.mu.RUnlock()
+	return append(rules, f.flagRules...)
+}
+
+func (f *Filter) rel(path string) (string, error) {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "", nil
+	}
+	if strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not under %s", path, f.root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func (f *Filter) String() string {
+	var patterns []string
+	for _, r := range f.flagRules {
+		if r.Include {
+			patterns = append(patterns, "include "+r.Pattern)
+		} else {
+			patterns = append(patterns, "exclude "+r.Pattern)
+		}
+	}
+	if len(f.ignoreFileName) > 0 {
+		patterns = append(patterns, "ignore files "+f.ignoreFileName)
+	}
+	if len(patterns) == 0 {
+		return "none"
+	}
+	return strings.Join(patterns, ", ")
+}
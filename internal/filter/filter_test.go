@@ -0,0 +1,85 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRule_matches(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{pattern: "*.tmp", path: "a.tmp", expected: true},
+		{pattern: "*.tmp", path: "one/two/a.tmp", expected: true},
+		{pattern: "*.tmp", path: "a.tmpx", expected: false},
+		{pattern: "node_modules/", path: "web/node_modules", isDir: true, expected: true},
+		{pattern: "node_modules/", path: "web/node_modules", isDir: false, expected: false},
+		{pattern: "/build", path: "build", isDir: true, expected: true},
+		{pattern: "/build", path: "src/build", isDir: true, expected: false},
+		{pattern: "docs/*.md", path: "docs/a.md", expected: true},
+		{pattern: "docs/*.md", path: "docs/sub/a.md", expected: false},
+		{pattern: "**/cache", path: "a/b/cache", isDir: true, expected: true},
+		{pattern: "logs/**", path: "logs/a/b.log", expected: true},
+		{pattern: "a/**/z", path: "a/z", expected: true},
+		{pattern: "a/**/z", path: "a/b/c/z", expected: true},
+		{pattern: "file?.[ch]", path: "file1.c", expected: true},
+		{pattern: "file[!0-9].txt", path: "file1.txt", expected: false},
+		{pattern: "file[!0-9].txt", path: "filex.txt", expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.path, func(t *testing.T) {
+			r, err := parseRule(tc.pattern, "", false)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, r.matches(tc.path, tc.isDir))
+		})
+	}
+}
+
+func TestParseRule_CommentsAndInvalid(t *testing.T) {
+	r, err := parseRule("# comment", "", false)
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+	r, err = parseRule("   ", "", false)
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+	_, err = parseRule("file[abc", "", false)
+	assert.Error(t, err)
+}
+
+func TestFilter_Excluded(t *testing.T) {
+	// given
+	root, err := os.MkdirTemp("", "filterRoot_*")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "project", "out"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, DefaultIgnoreFileName), []byte("*.log\n!keep.log\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "project", DefaultIgnoreFileName), []byte("# build output\n/out/\n"), 0644))
+	f, err := New(root, Options{
+		Excludes:       []string{".git/", "*.tmp"},
+		Includes:       []string{"important.tmp"},
+		IgnoreFileName: DefaultIgnoreFileName,
+	})
+	require.NoError(t, err)
+
+	// when
+	require.NoError(t, f.LoadDir(root))
+	require.NoError(t, f.LoadDir(filepath.Join(root, "project")))
+
+	// then
+	assert.False(t, f.Excluded(root, true))
+	assert.True(t, f.Excluded(filepath.Join(root, ".git"), true))
+	assert.True(t, f.Excluded(filepath.Join(root, "a.tmp"), false))
+	assert.False(t, f.Excluded(filepath.Join(root, "project", "important.tmp"), false))
+	assert.True(t, f.Excluded(filepath.Join(root, "project", "debug.log"), false))
+	assert.False(t, f.Excluded(filepath.Join(root, "project", "keep.log"), false))
+	assert.True(t, f.Excluded(filepath.Join(root, "project", "out"), true))
+	assert.False(t, f.Excluded(filepath.Join(root, "out"), true))
+	assert.False(t, f.Excluded(filepath.Join(root, "project", "main.go"), false))
+}
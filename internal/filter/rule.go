@@ -0,0 +1,107 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// rule is a single gitignore style pattern. Base is the slash separated directory, relative to the filter root,
+// that an anchored pattern is relative to and that limits the paths the rule applies to.
+type rule struct {
+	Pattern string
+	Base    string
+	Include bool
+	DirOnly bool
+	re      *regexp.Regexp
+}
+
+// parseRule parses a gitignore style line, returning a nil rule for blank lines and comments.
+// A leading ! re-includes, a trailing / matches directories only and a pattern with a leading or inner /
+// is anchored to base, otherwise it matches the name at any depth. *, ?, [...] and ** work as in gitignore.
+func parseRule(line, base string, include bool) (*rule, error) {
+	pattern := strings.TrimRight(line, " \t\r")
+	if len(pattern) == 0 || strings.HasPrefix(pattern, "#") {
+		return nil, nil
+	}
+	r := &rule{Pattern: pattern, Base: base, Include: include}
+	if strings.HasPrefix(pattern, "!") {
+		r.Include = !include
+		pattern = pattern[1:]
+	}
+	pattern = strings.TrimPrefix(pattern, `\`)
+	if strings.HasSuffix(pattern, "/") {
+		r.DirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("invalid filter pattern %q", line)
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	expression, err := globToRegexp(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter pattern %q: %v", line, err)
+	}
+	if !anchored {
+		expression = "(?:.*/)?" + expression
+	}
+	if r.re, err = regexp.Compile("^" + expression + "$"); err != nil {
+		return nil, fmt.Errorf("invalid filter pattern %q: %v", line, err)
+	}
+	return r, nil
+}
+
+// matches reports whether the slash separated path, relative to the filter root, matches the rule
+func (r *rule) matches(path string, isDir bool) bool {
+	if r.DirOnly && !isDir {
+		return false
+	}
+	if len(r.Base) > 0 {
+		if !strings.HasPrefix(path, r.Base+"/") {
+			return false
+		}
+		path = strings.TrimPrefix(path, r.Base+"/")
+	}
+	return r.re.MatchString(path)
+}
+
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
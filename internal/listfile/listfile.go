@@ -0,0 +1,341 @@
+package listfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatPlain is the legacy format, one path per line
+	FormatPlain = "plain"
+	// FormatCSV starts with a header row naming the columns
+	FormatCSV = "csv"
+	// FormatJSONL holds one JSON object per line
+	FormatJSONL = "jsonl"
+	// FormatNull holds one NUL terminated path per record, so paths may contain line breaks
+	FormatNull = "null"
+)
+
+const (
+	PathColumn    = "path"
+	SizeColumn    = "size"
+	ModTimeColumn = "mtime"
+	ModeColumn    = "mode"
+	InodeColumn   = "inode"
+	LinksColumn   = "links"
+)
+
+var csvHeader = []string{PathColumn, SizeColumn, ModTimeColumn, ModeColumn, InodeColumn, LinksColumn}
+
+// Record is a listed file. Records read from a plain list only have a Path.
+type Record struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Mode    fs.FileMode
+	Inode   uint64
+	Links   uint64
+}
+
+type jsonRecord struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Mode    string    `json:"mode"`
+	Inode   uint64    `json:"inode"`
+	Links   uint64    `json:"links"`
+}
+
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatPlain, FormatCSV, FormatJSONL, FormatNull:
+		return nil
+	default:
+		return fmt.Errorf("unknown list format %q, expecting %s, %s, %s or %s", format, FormatPlain, FormatCSV, FormatJSONL, FormatNull)
+	}
+}
+
+// Writer writes records in one of the list formats
+type Writer struct {
+	format string
+	w      io.Writer
+	csv    *csv.Writer
+}
+
+// NewWriter returns a writer of format, a CSV writer writes its header right away so an empty list keeps its format
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	if err := ValidateFormat(format); err != nil {
+		return nil, err
+	}
+	writer := &Writer{format: format, w: w}
+	if format == FormatCSV {
+		writer.csv = csv.NewWriter(w)
+		if err := writer.csv.Write(csvHeader); err != nil {
+			return nil, err
+		}
+	}
+	return writer, nil
+}
+
+func (w *Writer) Format() string {
+	return w.format
+}
+
+func (w *Writer) Write(record Record) error {
+	switch w.format {
+	case FormatCSV:
+		return w.csv.Write([]string{
+			record.Path,
+			strconv.FormatInt(record.Size, 10),
+			record.ModTime.Format(time.RFC3339Nano),
+			record.Mode.String(),
+			strconv.FormatUint(record.Inode, 10),
+			strconv.FormatUint(record.Links, 10),
+		})
+	case FormatJSONL:
+		data, err := json.Marshal(jsonRecord{
+			Path:    record.Path,
+			Size:    record.Size,
+			ModTime: record.ModTime,
+			Mode:    record.Mode.String(),
+			Inode:   record.Inode,
+			Links:   record.Links,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w.w, "%s\n", data)
+		return err
+	case FormatNull:
+		_, err := fmt.Fprintf(w.w, "%s\x00", record.Path)
+		return err
+	default:
+		_, err := fmt.Fprintf(w.w, "%s\n", record.Path)
+		return err
+	}
+}
+
+// Flush flushes a CSV writer, the other formats are written through
+func (w *Writer) Flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// Reader reads the records of a list in any format. A list holding a NUL is NUL terminated,
+// otherwise the format is detected from its first line.
+type Reader struct {
+	r       *bufio.Reader
+	format  string
+	pending *string
+	csv     *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+// detectionSize is the length of the list prefix searched for a NUL, longer than any path
+const detectionSize = 64 << 10
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, detectionSize)}
+}
+
+// NewReaderFormat returns a reader of a list in format, skipping the detection. A CSV list is always detected by its header.
+func NewReaderFormat(r io.Reader, format string) (*Reader, error) {
+	if err := ValidateFormat(format); err != nil {
+		return nil, err
+	}
+	reader := NewReader(r)
+	if format != FormatCSV {
+		reader.format = format
+	}
+	return reader, nil
+}
+
+// Format returns the detected format, or an empty string before the first Read
+func (r *Reader) Format() string {
+	return r.format
+}
+
+// Read returns the next record, or io.EOF at the end of the list
+func (r *Reader) Read() (Record, error) {
+	if len(r.format) == 0 {
+		if err := r.detect(); err != nil {
+			return Record{}, err
+		}
+	}
+	if r.format == FormatCSV {
+		return r.readCSV()
+	}
+	for {
+		line, err := r.nextLine()
+		if err != nil {
+			return Record{}, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if r.format == FormatPlain || r.format == FormatNull {
+			return Record{Path: line}, nil
+		}
+		return r.parseJSON(line)
+	}
+}
+
+func (r *Reader) detect() error {
+	_, _ = r.r.Peek(detectionSize)
+	if prefix, _ := r.r.Peek(r.r.Buffered()); bytes.IndexByte(prefix, 0) >= 0 {
+		r.format = FormatNull
+		return nil
+	}
+	line, err := r.readLine()
+	if errors.Is(err, io.EOF) && len(line) == 0 {
+		r.format = FormatPlain
+		return nil
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	switch {
+	case strings.HasPrefix(line, PathColumn+","):
+		r.format = FormatCSV
+		header, err := csv.NewReader(strings.NewReader(line)).Read()
+		if err != nil {
+			return fmt.Errorf("invalid list header: %v", err)
+		}
+		r.columns = make(map[string]int)
+		for i, column := range header {
+			r.columns[column] = i
+		}
+		r.csv = csv.NewReader(r.r)
+		r.csv.FieldsPerRecord = len(header)
+	case strings.HasPrefix(line, "{"):
+		r.format = FormatJSONL
+		r.pending = &line
+	default:
+		r.format = FormatPlain
+		r.pending = &line
+	}
+	return nil
+}
+
+func (r *Reader) nextLine() (string, error) {
+	if r.pending != nil {
+		line := *r.pending
+		r.pending = nil
+		return line, nil
+	}
+	line, err := r.readLine()
+	if errors.Is(err, io.EOF) && len(line) > 0 {
+		return line, nil
+	}
+	return line, err
+}
+
+func (r *Reader) readLine() (string, error) {
+	if r.format == FormatNull {
+		line, err := r.r.ReadString(0)
+		r.line++
+		return strings.TrimSuffix(line, "\x00"), err
+	}
+	line, err := r.r.ReadString('\n')
+	r.line++
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (r *Reader) parseJSON(line string) (Record, error) {
+	var rec jsonRecord
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		return Record{}, fmt.Errorf("invalid list line %d: %v", r.line, err)
+	}
+	mode, err := ParseMode(rec.Mode)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid list line %d: %v", r.line, err)
+	}
+	return Record{Path: rec.Path, Size: rec.Size, ModTime: rec.ModTime, Mode: mode, Inode: rec.Inode, Links: rec.Links}, nil
+}
+
+func (r *Reader) readCSV() (Record, error) {
+	fields, err := r.csv.Read()
+	if err != nil {
+		return Record{}, err
+	}
+	r.line++
+	line := r.line
+	field := func(column string) string {
+		if i, ok := r.columns[column]; ok {
+			return fields[i]
+		}
+		return ""
+	}
+	record := Record{Path: field(PathColumn)}
+	if value := field(SizeColumn); len(value) > 0 {
+		if record.Size, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return Record{}, fmt.Errorf("invalid list line %d: size %q", line, value)
+		}
+	}
+	if value := field(ModTimeColumn); len(value) > 0 {
+		if record.ModTime, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return Record{}, fmt.Errorf("invalid list line %d: mtime %q", line, value)
+		}
+	}
+	if value := field(ModeColumn); len(value) > 0 {
+		if record.Mode, err = ParseMode(value); err != nil {
+			return Record{}, fmt.Errorf("invalid list line %d: %v", line, err)
+		}
+	}
+	if value := field(InodeColumn); len(value) > 0 {
+		if record.Inode, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return Record{}, fmt.Errorf("invalid list line %d: inode %q", line, value)
+		}
+	}
+	if value := field(LinksColumn); len(value) > 0 {
+		if record.Links, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return Record{}, fmt.Errorf("invalid list line %d: links %q", line, value)
+		}
+	}
+	return record, nil
+}
+
+// modeTypeLetters are the type letters of fs.FileMode.String, the letter at index i stands for the bit 1<<(31-i)
+const modeTypeLetters = "dalTLDpSugct?"
+
+// ParseMode parses the output of fs.FileMode.String, e.g. -rw-r--r-- or drwxr-xr-x
+func ParseMode(s string) (fs.FileMode, error) {
+	const permLetters = "rwxrwxrwx"
+	if len(s) < len(permLetters)+1 {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+	var mode fs.FileMode
+	types, perms := s[:len(s)-len(permLetters)], s[len(s)-len(permLetters):]
+	if types != "-" {
+		for _, c := range types {
+			i := strings.IndexRune(modeTypeLetters, c)
+			if i < 0 {
+				return 0, fmt.Errorf("invalid mode %q", s)
+			}
+			mode |= 1 << uint(31-i)
+		}
+	}
+	for i, c := range perms {
+		switch c {
+		case rune(permLetters[i]):
+			mode |= 1 << uint(8-i)
+		case '-':
+		default:
+			return 0, fmt.Errorf("invalid mode %q", s)
+		}
+	}
+	return mode, nil
+}
@@ -0,0 +1,137 @@
+package listfile
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, r *Reader) []Record {
+	var records []Record
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return records
+		}
+		require.NoError(t, err)
+		records = append(records, record)
+	}
+}
+
+func TestWriterReader_RoundTrip(t *testing.T) {
+	records := []Record{
+		{Path: "/src/a.txt", Size: 12, ModTime: time.Date(2022, 3, 14, 12, 0, 0, 5, time.UTC), Mode: 0644, Inode: 42, Links: 1},
+		{Path: "/src/with, comma \"quoted\".bin", Size: 0, ModTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Mode: fs.ModeSetuid | 0755, Inode: 7, Links: 2},
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSONL, FormatPlain, FormatNull} {
+		t.Run(format, func(t *testing.T) {
+			// given
+			builder := &strings.Builder{}
+			writer, err := NewWriter(builder, format)
+			require.NoError(t, err)
+			for _, record := range records {
+				require.NoError(t, writer.Write(record))
+			}
+			require.NoError(t, writer.Flush())
+
+			// when
+			reader := NewReader(strings.NewReader(builder.String()))
+			actual := readAll(t, reader)
+
+			// then
+			assert.Equal(t, format, reader.Format())
+			require.Len(t, actual, len(records))
+			for i, record := range records {
+				if format == FormatPlain || format == FormatNull {
+					assert.Equal(t, Record{Path: record.Path}, actual[i])
+					continue
+				}
+				assert.Equal(t, record.Path, actual[i].Path)
+				assert.Equal(t, record.Size, actual[i].Size)
+				assert.True(t, record.ModTime.Equal(actual[i].ModTime))
+				assert.Equal(t, record.Mode, actual[i].Mode)
+				assert.Equal(t, record.Inode, actual[i].Inode)
+				assert.Equal(t, record.Links, actual[i].Links)
+			}
+		})
+	}
+}
+
+func TestReader_LegacyPlain(t *testing.T) {
+	reader := NewReader(strings.NewReader("/src/one\n\n/src/two"))
+	assert.Equal(t, []Record{{Path: "/src/one"}, {Path: "/src/two"}}, readAll(t, reader))
+	assert.Equal(t, FormatPlain, reader.Format())
+}
+
+func TestReader_EmptyCSV(t *testing.T) {
+	builder := &strings.Builder{}
+	writer, err := NewWriter(builder, FormatCSV)
+	require.NoError(t, err)
+	require.NoError(t, writer.Flush())
+
+	reader := NewReader(strings.NewReader(builder.String()))
+	assert.Empty(t, readAll(t, reader))
+	assert.Equal(t, FormatCSV, reader.Format())
+}
+
+func TestReader_Invalid(t *testing.T) {
+	_, err := NewReader(strings.NewReader("path,size\n/a,ten\n")).Read()
+	assert.EqualError(t, err, `invalid list line 2: size "ten"`)
+	_, err = NewReader(strings.NewReader("{\"path\": 1}\n")).Read()
+	assert.Error(t, err)
+}
+
+func TestParseMode(t *testing.T) {
+	for _, mode := range []fs.FileMode{0, 0644, 0755 | fs.ModeDir, fs.ModeSymlink | 0777, fs.ModeSetgid | fs.ModeSticky | 0700} {
+		parsed, err := ParseMode(mode.String())
+		assert.NoError(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+	_, err := ParseMode("rw-r--r--")
+	assert.Error(t, err)
+	_, err = ParseMode("-rw-r--r-q")
+	assert.Error(t, err)
+}
+
+func TestReader_Null(t *testing.T) {
+	// given
+	list := "/src/line\nbreak\x00/src/plain\x00/src/last"
+
+	// when
+	detected := NewReader(strings.NewReader(list))
+	explicit, err := NewReaderFormat(strings.NewReader(list), FormatNull)
+	require.NoError(t, err)
+
+	// then
+	expected := []Record{{Path: "/src/line\nbreak"}, {Path: "/src/plain"}, {Path: "/src/last"}}
+	assert.Equal(t, expected, readAll(t, detected))
+	assert.Equal(t, FormatNull, detected.Format())
+	assert.Equal(t, expected, readAll(t, explicit))
+}
+
+func TestNewReaderFormat_Plain(t *testing.T) {
+	reader, err := NewReaderFormat(strings.NewReader("{not json}\n/src/two\n"), FormatPlain)
+	require.NoError(t, err)
+	assert.Equal(t, []Record{{Path: "{not json}"}, {Path: "/src/two"}}, readAll(t, reader))
+	_, err = NewReaderFormat(strings.NewReader(""), "xml")
+	assert.Error(t, err)
+}
+
+func TestValidateFormat(t *testing.T) {
+	for _, format := range []string{FormatPlain, FormatCSV, FormatJSONL, FormatNull} {
+		assert.NoError(t, ValidateFormat(format), format)
+	}
+
+	err := ValidateFormat("xml")
+	require.Error(t, err)
+	for _, format := range []string{FormatPlain, FormatCSV, FormatJSONL, FormatNull} {
+		assert.Contains(t, err.Error(), format)
+	}
+}
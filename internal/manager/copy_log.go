@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+)
+
+const (
+	CopyLogStatusColumn       = "status"
+	CopyLogTargetColumn       = "target"
+	CopyLogSourceColumn       = "source"
+	CopyLogActionColumn       = "action"
+	CopyLogChecksumColumn     = "checksum_algorithm"
+	CopyLogSourceSumColumn    = "source_checksum"
+	CopyLogErrorMessageColumn = "error_message"
+	CopyStatusSuccess         = "true"
+	CopyStatusFailure         = "false"
+	// CopyStatusSkipped is the status of a file whose target was left as is since it matched the source
+	CopyStatusSkipped = "skipped"
+)
+
+var copyLogHeader = []string{
+	CopyLogStatusColumn, "duration [milli-sec]", CopyLogTargetColumn, CopyLogSourceColumn, "not_preserved",
+	CopyLogChecksumColumn, CopyLogSourceSumColumn, "target_checksum", "attempts", CopyLogActionColumn,
+	"logical_bytes", "physical_bytes", CopyLogErrorMessageColumn,
+}
+
+// CopyLogEntry is a single file row of a copy batch log
+type CopyLogEntry struct {
+	Status     string
+	TargetPath string
+	SourcePath string
+	// Action is empty in logs written before the action column was added
+	Action string
+	// ChecksumAlgorithm and SourceChecksum are empty unless the copy was verified
+	ChecksumAlgorithm string
+	SourceChecksum    string
+	ErrorMessage      string
+}
+
+func fileCopyResponseRecord(r tasks.BackupFileResponse) []string {
+	duration := r.CompletionTime.Sub(r.CreationRequestTime).Milliseconds()
+	status := strconv.FormatBool(r.CompletionStatus)
+	if r.Skipped {
+		status = CopyStatusSkipped
+	}
+	return []string{
+		status,
+		strconv.FormatInt(duration, 10),
+		r.TargetPath,
+		r.SourcePath,
+		strings.Join(r.NotPreserved, ";"),
+		r.ChecksumAlgorithm,
+		r.SourceChecksum,
+		r.TargetChecksum,
+		strconv.FormatUint(uint64(r.Attempts), 10),
+		r.Action,
+		strconv.FormatInt(r.LogicalBytes, 10),
+		strconv.FormatInt(r.PhysicalBytes, 10),
+		r.ErrorMessage,
+	}
+}
+
+// ReadCopyLog parses a copy batch log written by HandleFilesCopyResponse.
+// Columns are located by the header, so logs written before columns were added are read as well.
+func ReadCopyLog(logReader io.Reader) ([]CopyLogEntry, error) {
+	reader := csv.NewReader(logReader)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read copy log header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{CopyLogStatusColumn, CopyLogTargetColumn, CopyLogSourceColumn} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("copy log header is missing the %s column", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	var entries []CopyLogEntry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, fmt.Errorf("failed to read copy log: %w", err)
+		}
+		entries = append(entries, CopyLogEntry{
+			Status:            field(record, CopyLogStatusColumn),
+			TargetPath:        field(record, CopyLogTargetColumn),
+			SourcePath:        field(record, CopyLogSourceColumn),
+			Action:            field(record, CopyLogActionColumn),
+			ChecksumAlgorithm: field(record, CopyLogChecksumColumn),
+			SourceChecksum:    field(record, CopyLogSourceSumColumn),
+			ErrorMessage:      field(record, CopyLogErrorMessageColumn),
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCopyLog(t *testing.T) {
+	testCases := []struct {
+		title           string
+		log             string
+		expected        []CopyLogEntry
+		isErrorExpected bool
+	}{
+		{
+			title: "empty log",
+			log:   "",
+		}, {
+			title: "legacy log with fewer columns",
+			log: "status,duration [milli-sec],target,source,error_message\n" +
+				"true,3,/target/one,/src/one,success\n" +
+				"false,1,/target/two,/src/two,stat /src/two: no such file or directory\n",
+			expected: []CopyLogEntry{
+				{Status: "true", TargetPath: "/target/one", SourcePath: "/src/one", ErrorMessage: "success"},
+				{Status: "false", TargetPath: "/target/two", SourcePath: "/src/two", ErrorMessage: "stat /src/two: no such file or directory"},
+			},
+		}, {
+			title:           "missing source column",
+			log:             "status,target\ntrue,/target/one\n",
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			entries, err := ReadCopyLog(strings.NewReader(tc.log))
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, entries)
+		})
+	}
+}
+
+func TestReadCopyLog_RoundTrip(t *testing.T) {
+	// given
+	responseChan := make(chan tasks.BackupFileResponse, 3)
+	now := time.Now()
+	responses := []tasks.BackupFileResponse{
+		{
+			CreationRequestTime: now,
+			CompletionTime:      now,
+			SourcePath:          "/src/with, comma",
+			TargetPath:          "/target/with, comma",
+			CompletionStatus:    true,
+			ChecksumAlgorithm:   tasks.ChecksumXXHash,
+			SourceChecksum:      "9a2c3f1e8b7d6054",
+			TargetChecksum:      "9a2c3f1e8b7d6054",
+			ErrorMessage:        "success",
+		}, {
+			CreationRequestTime: now,
+			CompletionTime:      now,
+			SourcePath:          "/src/failed",
+			TargetPath:          "/target/failed",
+			Err:                 errors.New("read /src/failed: input/output error"),
+			ErrorMessage:        "read /src/failed: input/output error",
+		}, {
+			CreationRequestTime: now,
+			CompletionTime:      now,
+			SourcePath:          "/src/unchanged",
+			TargetPath:          "/target/unchanged",
+			Action:              tasks.ActionCopy,
+			CompletionStatus:    true,
+			Skipped:             true,
+			ErrorMessage:        "unchanged (size-mtime)",
+		},
+	}
+	var logWriter strings.Builder
+	api := NewService(ServiceInitInput{})
+	done := make(chan struct{})
+	go func() {
+		api.HandleFilesCopyResponse(&logWriter, responseChan)
+		close(done)
+	}()
+
+	// when
+	for _, resp := range responses {
+		wgRequestResponseCorelator.Add(1)
+		responseChan <- resp
+	}
+	api.WaitForAllResponses()
+	close(responseChan)
+	<-done
+	entries, err := ReadCopyLog(strings.NewReader(logWriter.String()))
+
+	// then
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, CopyLogEntry{
+		Status:            CopyStatusSuccess,
+		TargetPath:        "/target/with, comma",
+		SourcePath:        "/src/with, comma",
+		ChecksumAlgorithm: tasks.ChecksumXXHash,
+		SourceChecksum:    "9a2c3f1e8b7d6054",
+		ErrorMessage:      "success",
+	}, entries[0])
+	assert.Equal(t, CopyStatusFailure, entries[1].Status)
+	assert.Equal(t, "/src/failed", entries[1].SourcePath)
+	assert.Equal(t, CopyStatusSkipped, entries[2].Status)
+}
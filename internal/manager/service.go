@@ -2,38 +2,95 @@ package manager
 
 import (
 	"bufio"
+	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/AppleGamer22/recursive-backup/internal/filter"
+	"github.com/AppleGamer22/recursive-backup/internal/listfile"
+	"github.com/AppleGamer22/recursive-backup/internal/manifest"
 	"github.com/AppleGamer22/recursive-backup/internal/rberrors"
 	"github.com/AppleGamer22/recursive-backup/internal/tasks"
 	val "github.com/AppleGamer22/recursive-backup/internal/validationhelpers"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
+// API runs the backup stages. Every Context variant stops promptly once its context is done and returns a wrapped ctx.Err().
 type API interface {
 	ListSources(dirsWriter, filesWriter, errorsWriter io.Writer, referenceTime *time.Time) error
+	ListSourcesContext(ctx context.Context, dirsWriter, filesWriter, errorsWriter io.Writer, referenceTime *time.Time) error
 	// ListSourcesReferenceTime(dirsWriter, filesWriter, errorsWriter io.Writer) error
 	CreateTargetDirSkeleton(dirsReader io.Reader, errorsWriter io.Writer, validationMode string) (io.Reader, error)
+	CreateTargetDirSkeletonContext(ctx context.Context, dirsReader io.Reader, errorsWriter io.Writer, validationMode string) (io.Reader, error)
 	RequestFilesCopy(filesList io.Reader, batchID uint, requestChan chan tasks.GeneralRequest, responseChan chan tasks.BackupFileResponse)
+	RequestFilesCopyContext(ctx context.Context, filesList io.Reader, batchID uint, requestChan chan tasks.GeneralRequest, responseChan chan tasks.BackupFileResponse) error
 	HandleFilesCopyResponse(logWriter io.Writer, responseChan chan tasks.BackupFileResponse)
+	HandleFilesCopyResponseContext(ctx context.Context, logWriter io.Writer, responseChan chan tasks.BackupFileResponse) error
+	AppendFilesCopyResponse(logWriter io.Writer, responseChan chan tasks.BackupFileResponse)
 	WaitForAllResponses()
+	RemoveOrphanedTempFiles(filesList io.Reader) ([]string, error)
+	HandleTargetDeletions(srcDirsList, srcFilesList io.Reader, deletionsWriter io.Writer, policy, trashDir string) (tasks.DeletionsResult, error)
+	HandleTargetDeletionsContext(ctx context.Context, srcDirsList, srcFilesList io.Reader, deletionsWriter io.Writer, policy, trashDir string) (tasks.DeletionsResult, error)
 }
 
 type service struct {
 	SourceRootDir string
 	TargetRootDir string
+	CopyOptions   tasks.CopyOptions
+	Filter        filter.Options
+	ListCriteria  tasks.ListCriteria
+	ListFormat    string
+	// NullDelimited lists paths terminated by NUL instead of a line break, see listfile.FormatNull
+	NullDelimited bool
+	ListWorkers   int
+	ListSorted    bool
+	Symlinks      string
+	HardLinks     io.Writer
+	Special       tasks.SpecialFilePolicy
+	SpecialFiles  io.Writer
+	Manifest      io.Writer
+	Baseline      *manifest.Manifest
+	Changes       io.Writer
+	// sweptDirs are the target dirs RemoveOrphanedTempFiles already swept
+	sweptDirs map[string]bool
 	// RecoveryReferenceTime time.Time
 }
 
 type ServiceInitInput struct {
 	SourceRootDir string
 	TargetRootDir string
+	CopyOptions   tasks.CopyOptions
+	Filter        filter.Options
+	ListCriteria  tasks.ListCriteria
+	ListFormat    string
+	// NullDelimited lists paths terminated by NUL instead of a line break, see listfile.FormatNull
+	NullDelimited bool
+	// ListWorkers is the number of source directories read concurrently by the lister
+	ListWorkers int
+	// ListSorted writes the lists of several ListWorkers in the order of a sequential walk
+	ListSorted bool
+	// Symlinks is the symlink policy of the lister, the skeleton and the copies, see tasks.SymlinksSkip
+	Symlinks string
+	// HardLinks receives the hard links list of ListSources, the listed files with more than one link. Nil does not list them.
+	HardLinks io.Writer
+	// Special is the special file policy of the lister and the copies, see tasks.SpecialFilePolicy
+	Special tasks.SpecialFilePolicy
+	// SpecialFiles receives the special files list of ListSources, the reported and recreated ones. Nil does not list them.
+	SpecialFiles io.Writer
+	// Manifest receives the manifest of ListSources, every listed dir and file. Nil does not write it.
+	Manifest io.Writer
+	// Baseline is the manifest of a previous backup, ListSources lists only the entries changed since then
+	Baseline *manifest.Manifest
+	// Changes receives the changes list of ListSources with a Baseline, the added, modified and deleted entries
+	Changes io.Writer
 	// RecoveryReferenceTime time.Time
 }
 
@@ -47,19 +104,61 @@ func (i ServiceInitInput) Validate() error {
 }
 
 func NewService(in ServiceInitInput) API {
+	copyOptions := in.CopyOptions
+	copyOptions.Symlinks = in.Symlinks
+	copyOptions.Special = in.Special
 	return &service{
 		SourceRootDir: in.SourceRootDir,
 		TargetRootDir: in.TargetRootDir,
+		CopyOptions:   copyOptions,
+		Filter:        in.Filter,
+		ListCriteria:  in.ListCriteria,
+		ListFormat:    in.ListFormat,
+		NullDelimited: in.NullDelimited,
+		ListWorkers:   in.ListWorkers,
+		ListSorted:    in.ListSorted,
+		Symlinks:      in.Symlinks,
+		HardLinks:     in.HardLinks,
+		Special:       in.Special,
+		SpecialFiles:  in.SpecialFiles,
+		Manifest:      in.Manifest,
+		Baseline:      in.Baseline,
+		Changes:       in.Changes,
+		sweptDirs:     make(map[string]bool),
 	}
 }
 
 func (m *service) ListSources(dirsWriter, filesWriter, errorsWriter io.Writer, referenceTime *time.Time) error {
+	return m.ListSourcesContext(context.Background(), dirsWriter, filesWriter, errorsWriter, referenceTime)
+}
+
+func (m *service) ListSourcesContext(ctx context.Context, dirsWriter, filesWriter, errorsWriter io.Writer, referenceTime *time.Time) error {
+	var sourceFilter *filter.Filter
+	if len(m.Filter.Excludes) > 0 || len(m.Filter.Includes) > 0 || len(m.Filter.IgnoreFileName) > 0 {
+		var err error
+		if sourceFilter, err = filter.New(m.SourceRootDir, m.Filter); err != nil {
+			return err
+		}
+	}
 	newSourceListerInput := &tasks.NewSrcListerInput{
-		SrcRootDir:    m.SourceRootDir,
-		DirsWriter:    dirsWriter,
-		FilesWriter:   filesWriter,
-		ErrorsWriter:  errorsWriter,
-		ReferenceTime: referenceTime,
+		SrcRootDir:      m.SourceRootDir,
+		DirsWriter:      dirsWriter,
+		FilesWriter:     filesWriter,
+		ErrorsWriter:    errorsWriter,
+		ReferenceTime:   referenceTime,
+		Filter:          sourceFilter,
+		ListCriteria:    m.ListCriteria,
+		ListFormat:      m.ListFormat,
+		NullDelimited:   m.NullDelimited,
+		Workers:         m.ListWorkers,
+		Sorted:          m.ListSorted,
+		Symlinks:        m.Symlinks,
+		HardLinksWriter: m.HardLinks,
+		SpecialWriter:   m.SpecialFiles,
+		Special:         m.Special,
+		ManifestWriter:  m.Manifest,
+		Baseline:        m.Baseline,
+		ChangesWriter:   m.Changes,
 	}
 
 	sourceLister, err := tasks.NewSourceLister(newSourceListerInput)
@@ -67,13 +166,17 @@ func (m *service) ListSources(dirsWriter, filesWriter, errorsWriter io.Writer, r
 		return err
 	}
 
-	return sourceLister.Do()
+	return sourceLister.DoContext(ctx)
 }
 
 func (m *service) CreateTargetDirSkeleton(srcDirsReader io.Reader, errorsWriter io.Writer, validationMode string) (io.Reader, error) {
+	return m.CreateTargetDirSkeletonContext(context.Background(), srcDirsReader, errorsWriter, validationMode)
+}
+
+func (m *service) CreateTargetDirSkeletonContext(ctx context.Context, srcDirsReader io.Reader, errorsWriter io.Writer, validationMode string) (io.Reader, error) {
 	bufferedErrorsWriter := bufio.NewWriter(errorsWriter)
-	task := tasks.NewBackupDirSkeleton(srcDirsReader, m.SourceRootDir, m.TargetRootDir, validationMode)
-	createdDirsReader, errs := task.Do()
+	task := tasks.NewBackupDirSkeleton(srcDirsReader, m.SourceRootDir, m.TargetRootDir, validationMode, m.NullDelimited, m.Symlinks)
+	createdDirsReader, errs := task.DoContext(ctx)
 	if validationMode == "report" || validationMode == "block" {
 		for _, err := range errs {
 			switch err.(type) {
@@ -92,6 +195,9 @@ func (m *service) CreateTargetDirSkeleton(srcDirsReader io.Reader, errorsWriter
 		}
 	}
 	_ = bufferedErrorsWriter.Flush()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return createdDirsReader, fmt.Errorf("CreateTargetDirSkeleton stopped: %w", ctxErr)
+	}
 	if len(errs) > 0 {
 		return createdDirsReader, errors.New("CreateTargetDirSkeleton completed with errors")
 	}
@@ -99,42 +205,175 @@ func (m *service) CreateTargetDirSkeleton(srcDirsReader io.Reader, errorsWriter
 }
 
 func (m *service) RequestFilesCopy(filesList io.Reader, batchID uint, requestChan chan tasks.GeneralRequest, responseChan chan tasks.BackupFileResponse) {
-	scanner := bufio.NewScanner(filesList)
+	_ = m.RequestFilesCopyContext(context.Background(), filesList, batchID, requestChan, responseChan)
+}
+
+// RequestFilesCopyContext stops requesting copies once ctx is done, returning a wrapped ctx.Err().
+// Requests that were already queued are still answered on responseChan. filesList may be in any listfile format.
+func (m *service) RequestFilesCopyContext(ctx context.Context, filesList io.Reader, batchID uint, requestChan chan tasks.GeneralRequest, responseChan chan tasks.BackupFileResponse) error {
+	reader, err := m.newFilesListReader(filesList)
+	if err != nil {
+		return err
+	}
 	var fileID uint = 0
-	for scanner.Scan() {
-		srcFullPath := scanner.Text()
-		filePath := strings.TrimPrefix(srcFullPath, m.SourceRootDir)
-		targetFullPath := filepath.Join(m.TargetRootDir, filePath)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf("files copy requests stopped for batch %d: %w", batchID, err)
+		}
+		srcFullPath := record.Path
+		targetFullPath := m.targetPath(srcFullPath)
 		copyFileTask := tasks.BackupFileRequest{
 			FileID:              fileID,
 			BatchID:             batchID,
 			CreationRequestTime: time.Now(),
 			SourcePath:          srcFullPath,
 			TargetPath:          targetFullPath,
+			Options:             m.CopyOptions,
 			ResponseChannel:     responseChan,
 		}
-		requestChan <- copyFileTask
+		var request tasks.GeneralRequest = copyFileTask
+		mode := m.recordMode(record)
+		if m.Symlinks == tasks.SymlinksCopyLink && mode&fs.ModeSymlink != 0 {
+			request = tasks.BackupSymlinkRequest(copyFileTask)
+		}
+		if kind, _ := m.Special.For(mode); len(kind) > 0 {
+			request = tasks.BackupSpecialFileRequest(copyFileTask)
+		}
 		wgRequestResponseCorelator.Add(1)
+		select {
+		case requestChan <- request:
+		case <-ctx.Done():
+			wgRequestResponseCorelator.Done()
+			return fmt.Errorf("files copy requests stopped for batch %d: %w", batchID, ctx.Err())
+		}
 		fileID++
 	}
 }
 
+// recordMode returns the type of a listed file, which tells symlinks and special files from regular files.
+// The mode of records from a plain list is unknown, so their source is checked as the symlink policy sees it,
+// unless neither symlinks nor special files are recreated and every record is a plain copy request.
+func (m *service) recordMode(record listfile.Record) fs.FileMode {
+	if record.Mode != 0 {
+		return record.Mode
+	}
+	if m.Symlinks != tasks.SymlinksCopyLink && !m.Special.Recreates() {
+		return 0
+	}
+	stat := os.Lstat
+	if m.Symlinks == tasks.SymlinksFollow {
+		stat = os.Stat
+	}
+	info, err := stat(record.Path)
+	if err != nil {
+		return 0
+	}
+	return info.Mode()
+}
+
 func (m *service) HandleFilesCopyResponse(logWriter io.Writer, responseChan chan tasks.BackupFileResponse) {
-	buf := bufio.NewWriter(logWriter)
-	headerLine := "status,duration [milli-sec],target,source,error_message\n"
-	_, _ = buf.WriteString(headerLine)
-	for resp := range responseChan {
-		_, _ = buf.WriteString(fileCopyResponseString(resp))
-		_ = buf.Flush()
-		wgRequestResponseCorelator.Done()
+	_ = m.HandleFilesCopyResponseContext(context.Background(), logWriter, responseChan)
+}
+
+// HandleFilesCopyResponseContext keeps logging until responseChan is closed even once ctx is done,
+// since the responses of stopped copies are still sent and record which files were not copied.
+// It then returns a wrapped ctx.Err(), so callers can tell an interrupted log from a complete one.
+func (m *service) HandleFilesCopyResponseContext(ctx context.Context, logWriter io.Writer, responseChan chan tasks.BackupFileResponse) error {
+	writer := csv.NewWriter(logWriter)
+	_ = writer.Write(copyLogHeader)
+	writeFilesCopyResponses(writer, responseChan)
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("files copy responses interrupted: %w", err)
 	}
+	return writer.Error()
+}
+
+// AppendFilesCopyResponse continues an existing copy log, so its header is not written again
+func (m *service) AppendFilesCopyResponse(logWriter io.Writer, responseChan chan tasks.BackupFileResponse) {
+	writeFilesCopyResponses(csv.NewWriter(logWriter), responseChan)
 }
 
-func fileCopyResponseString(r tasks.BackupFileResponse) string {
-	duration := r.CompletionTime.Sub(r.CreationRequestTime).Milliseconds()
-	return fmt.Sprintf("%t,%d,%s,%s,%s\n", r.CompletionStatus, duration, r.TargetPath, r.SourcePath, r.ErrorMessage)
+func writeFilesCopyResponses(writer *csv.Writer, responseChan chan tasks.BackupFileResponse) {
+	for resp := range responseChan {
+		_ = writer.Write(fileCopyResponseRecord(resp))
+		writer.Flush()
+		wgRequestResponseCorelator.Done()
+	}
 }
 
 func (m *service) WaitForAllResponses() {
 	wgRequestResponseCorelator.Wait()
 }
+
+// newFilesListReader reads a files list of any listfile format, or a NUL terminated one with NullDelimited
+func (m *service) newFilesListReader(filesList io.Reader) (*listfile.Reader, error) {
+	if m.NullDelimited {
+		return listfile.NewReaderFormat(filesList, listfile.FormatNull)
+	}
+	return listfile.NewReader(filesList), nil
+}
+
+// targetPath returns the copy of the source at srcFullPath in the target root dir
+func (m *service) targetPath(srcFullPath string) string {
+	return filepath.Join(m.TargetRootDir, strings.TrimPrefix(srcFullPath, m.SourceRootDir))
+}
+
+// RemoveOrphanedTempFiles deletes temp files that interrupted copies left in the target dirs of the files in filesList,
+// so the cleanup only reads the dirs a batch copies into instead of the whole target tree.
+// A dir is swept once per service, it returns the first error after sweeping the other dirs.
+func (m *service) RemoveOrphanedTempFiles(filesList io.Reader) ([]string, error) {
+	reader, err := m.newFilesListReader(filesList)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	var sweepErr error
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return removed, sweepErr
+		}
+		if err != nil {
+			return removed, err
+		}
+		dir := filepath.Dir(m.targetPath(record.Path))
+		if m.sweptDirs[dir] {
+			continue
+		}
+		m.sweptDirs[dir] = true
+		dirRemoved, err := tasks.RemoveOrphanedTempFiles(dir)
+		removed = append(removed, dirRemoved...)
+		if err != nil && sweepErr == nil {
+			sweepErr = err
+		}
+	}
+}
+
+func (m *service) HandleTargetDeletions(srcDirsList, srcFilesList io.Reader, deletionsWriter io.Writer, policy, trashDir string) (tasks.DeletionsResult, error) {
+	return m.HandleTargetDeletionsContext(context.Background(), srcDirsList, srcFilesList, deletionsWriter, policy, trashDir)
+}
+
+// HandleTargetDeletionsContext lists the target entries whose source was deleted, comparing the target root with the
+// source lists of ListSources, and reports, trashes or removes them by policy
+func (m *service) HandleTargetDeletionsContext(ctx context.Context, srcDirsList, srcFilesList io.Reader, deletionsWriter io.Writer, policy, trashDir string) (tasks.DeletionsResult, error) {
+	task, err := tasks.NewTargetDeletions(&tasks.NewTargetDeletionsInput{
+		SrcRootDir:      m.SourceRootDir,
+		TargetRootDir:   m.TargetRootDir,
+		SrcDirsList:     srcDirsList,
+		SrcFilesList:    srcFilesList,
+		DeletionsWriter: deletionsWriter,
+		Policy:          policy,
+		TrashDir:        trashDir,
+	})
+	if err != nil {
+		return tasks.DeletionsResult{}, err
+	}
+	return task.DoContext(ctx)
+}
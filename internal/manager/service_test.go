@@ -1,6 +1,8 @@
 package manager
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,6 +13,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/AppleGamer22/recursive-backup/internal/listfile"
 	"github.com/AppleGamer22/recursive-backup/internal/workers"
 
 	"github.com/AppleGamer22/recursive-backup/internal/tasks"
@@ -122,6 +125,26 @@ func TestListSources(t *testing.T) {
 	}
 }
 
+func TestListSourcesContext_Cancelled(t *testing.T) {
+	// given
+	srcRootDir, err := os.MkdirTemp("", "testListSrcDir_*")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "file.txt"), []byte("data"), 0644))
+	filesWriter := &strings.Builder{}
+	api := NewService(ServiceInitInput{
+		SourceRootDir: srcRootDir,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	err = api.ListSourcesContext(ctx, &strings.Builder{}, filesWriter, &strings.Builder{}, nil)
+
+	// then
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Empty(t, filesWriter.String())
+}
+
 func TestCreateTargetDirSkeleton(t *testing.T) {
 	// given
 	srcRootDir, err := os.MkdirTemp("", "testCreateTargetDirSkeleton_*")
@@ -278,7 +301,7 @@ func TestFilesCopySuccess(t *testing.T) {
 	expectedLogsFunc := func(t *testing.T, testRootDir string, filePaths, missingPaths []string) []string {
 		var out []string
 		for _, p := range filePaths {
-			out = append(out, fmt.Sprintf("true,0,%s,%s,%s", filepath.Join(testRootDir, "target", p), filepath.Join(testRootDir, "src", p), "success"))
+			out = append(out, fmt.Sprintf("true,0,%s,%s,,,,,1,%s,5,5,%s", filepath.Join(testRootDir, "target", p), filepath.Join(testRootDir, "src", p), tasks.ActionCopy, "success"))
 		}
 		for _, p := range missingPaths {
 			var errorMsg string
@@ -287,7 +310,7 @@ func TestFilesCopySuccess(t *testing.T) {
 			} else {
 				errorMsg = fmt.Sprintf("stat %s: no such file or directory", filepath.Join(testRootDir, "src", p))
 			}
-			out = append(out, fmt.Sprintf("false,0,%s,%s,%s", filepath.Join(testRootDir, "target", p), filepath.Join(testRootDir, "src", p), errorMsg))
+			out = append(out, fmt.Sprintf("false,0,%s,%s,,,,,1,%s,0,0,%s", filepath.Join(testRootDir, "target", p), filepath.Join(testRootDir, "src", p), tasks.ActionCopy, errorMsg))
 		}
 		return out
 	}
@@ -351,7 +374,13 @@ func TestFilesCopySuccess(t *testing.T) {
 
 			for i := 0; i < cap(tc.generalRequestChan); i++ {
 				wgRequest.Add(1)
-				workers.NewCopyWorker(uint(i), srcTestPath, targetTestPath, tc.generalRequestChan, updateOnQuit)
+				workers.NewCopyWorker(&workers.NewCopyWorkerInput{
+					ID:             uint(i),
+					SourceRootPath: srcTestPath,
+					TargetRootPath: targetTestPath,
+					Pipeline:       tc.generalRequestChan,
+					QuitFunc:       updateOnQuit,
+				})
 			}
 			var logWriter strings.Builder
 			go api.HandleFilesCopyResponse(&logWriter, tc.responseChan)
@@ -371,10 +400,13 @@ func TestFilesCopySuccess(t *testing.T) {
 			expectedString := strings.Join(expectedLogs, "\n")
 			logSlices := strings.Split(logString, "\n")
 			assert.Equal(t, len(tc.filesSubPaths)+len(tc.missingFilesSubPaths)+1, len(logSlices), logSlices)
-			assert.Equal(t, "status,duration [milli-sec],target,source,error_message", logSlices[0])
+			assert.Equal(t, "status,duration [milli-sec],target,source,not_preserved,checksum_algorithm,source_checksum,target_checksum,attempts,action,logical_bytes,physical_bytes,error_message", logSlices[0])
 			partialLogSlices := logSlices[1:]
 			require.Len(t, partialLogSlices, len(tc.filesSubPaths)+len(tc.missingFilesSubPaths))
 			sort.Strings(partialLogSlices)
+			for i, expectedLine := range expectedLogs {
+				assert.Equal(t, strings.Count(expectedLine, ","), strings.Count(partialLogSlices[i], ","), "unexpected line length")
+			}
 			assert.Equal(t, len(tc.filesSubPaths), strings.Count(logString, "success"))
 			for _, subPath := range tc.filesSubPaths {
 				srcPath := filepath.Join(srcTestPath, subPath)
@@ -420,3 +452,75 @@ func TestFilesCopySuccess(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestFilesCopy_ListFormats(t *testing.T) {
+	paths := []string{"/src/one", "/src/with,comma"}
+	for _, format := range []string{listfile.FormatPlain, listfile.FormatCSV, listfile.FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			// given
+			var filesList strings.Builder
+			writer, err := listfile.NewWriter(&filesList, format)
+			require.NoError(t, err)
+			for _, p := range paths {
+				require.NoError(t, writer.Write(listfile.Record{Path: p, Size: 5}))
+			}
+			require.NoError(t, writer.Flush())
+			api := NewService(ServiceInitInput{SourceRootDir: "/src", TargetRootDir: "/target"})
+			requestChan := make(chan tasks.GeneralRequest, len(paths))
+
+			// when
+			err = api.RequestFilesCopyContext(context.Background(), strings.NewReader(filesList.String()), 1, requestChan, nil)
+
+			// then
+			assert.NoError(t, err)
+			close(requestChan)
+			var targets []string
+			for request := range requestChan {
+				targets = append(targets, request.(tasks.BackupFileRequest).TargetPath)
+				wgRequestResponseCorelator.Done()
+			}
+			assert.Equal(t, []string{filepath.Join("/target", "one"), filepath.Join("/target", "with,comma")}, targets)
+		})
+	}
+}
+
+func TestRemoveOrphanedTempFiles(t *testing.T) {
+	// given
+	testRootDir, err := os.MkdirTemp("", "testOrphans_*")
+	require.NoError(t, err)
+	srcDirPath := filepath.Join(testRootDir, "src")
+	targetDirPath := filepath.Join(testRootDir, "target")
+	for _, dir := range []string{filepath.Join("a", "deep"), "b"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(targetDirPath, dir), 0755))
+	}
+	orphan := filepath.Join(targetDirPath, "a", ".x.txt.1"+tasks.TempFileSuffix)
+	keptPaths := []string{
+		filepath.Join(targetDirPath, "a", "deep", ".x.txt.2"+tasks.TempFileSuffix),
+		filepath.Join(targetDirPath, "b", ".x.txt.3"+tasks.TempFileSuffix),
+	}
+	for _, p := range append(keptPaths, orphan) {
+		require.NoError(t, os.WriteFile(p, []byte("data"), 0644))
+	}
+	filesList := fmt.Sprintf("%s\n%s\n%s\n", filepath.Join(srcDirPath, "a", "x.txt"), filepath.Join(srcDirPath, "a", "y.txt"),
+		filepath.Join(srcDirPath, "missing", "z.txt"))
+	api := NewService(ServiceInitInput{SourceRootDir: srcDirPath, TargetRootDir: targetDirPath})
+
+	// when
+	removed, err := api.RemoveOrphanedTempFiles(strings.NewReader(filesList))
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, []string{orphan}, removed, "only the target dirs of the listed files are swept")
+	for _, p := range keptPaths {
+		assert.FileExists(t, p)
+	}
+
+	// and when a dir is listed again
+	require.NoError(t, os.WriteFile(orphan, []byte("data"), 0644))
+	removed, err = api.RemoveOrphanedTempFiles(strings.NewReader(filesList))
+
+	// then
+	require.NoError(t, err)
+	assert.Empty(t, removed, "a dir is swept once per run")
+	assert.FileExists(t, orphan)
+}
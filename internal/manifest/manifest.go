@@ -0,0 +1,217 @@
+package manifest
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/listfile"
+)
+
+const (
+	// Added is an entry missing from the manifest, or one whose type changed
+	Added = "added"
+	// Modified is a file whose size, mtime or inode differs from the manifest
+	Modified = "modified"
+	// Deleted is a manifest entry that is no longer listed
+	Deleted = "deleted"
+	// Unchanged is an entry matching the manifest
+	Unchanged = "unchanged"
+)
+
+const (
+	PathColumn              = "path"
+	ModeColumn              = "mode"
+	SizeColumn              = "size"
+	ModTimeColumn           = "mtime"
+	InodeColumn             = "inode"
+	ChecksumAlgorithmColumn = "checksum_algorithm"
+	ChecksumColumn          = "checksum"
+)
+
+var header = []string{PathColumn, ModeColumn, SizeColumn, ModTimeColumn, InodeColumn, ChecksumAlgorithmColumn, ChecksumColumn}
+
+// Entry is a source dir or file of a completed backup, its Path is relative to the source root dir
+type Entry struct {
+	Path    string
+	Mode    fs.FileMode
+	Size    int64
+	ModTime time.Time
+	Inode   uint64
+	// ChecksumAlgorithm and Checksum are empty unless the content of the file was verified
+	ChecksumAlgorithm string
+	Checksum          string
+}
+
+// Compare returns how entry changed since the manifest entry m.
+// The mtime is compared for equality, so files restored with an older mtime are modified as well.
+// A directory is never modified, its mtime changes with its children.
+func (m Entry) Compare(entry Entry) string {
+	switch {
+	case m.Mode.Type() != entry.Mode.Type():
+		return Added
+	case entry.Mode.IsDir():
+		return Unchanged
+	case m.Size != entry.Size || !m.ModTime.Equal(entry.ModTime):
+		return Modified
+	case m.Inode != 0 && entry.Inode != 0 && m.Inode != entry.Inode:
+		return Modified
+	default:
+		return Unchanged
+	}
+}
+
+// Writer writes a manifest as CSV
+type Writer struct {
+	csv *csv.Writer
+}
+
+// NewWriter returns a manifest writer, writing the header right away so an empty manifest can be read
+func NewWriter(w io.Writer) (*Writer, error) {
+	writer := &Writer{csv: csv.NewWriter(w)}
+	if err := writer.csv.Write(header); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *Writer) Write(entry Entry) error {
+	return w.csv.Write([]string{
+		entry.Path,
+		entry.Mode.String(),
+		strconv.FormatInt(entry.Size, 10),
+		entry.ModTime.Format(time.RFC3339Nano),
+		strconv.FormatUint(entry.Inode, 10),
+		entry.ChecksumAlgorithm,
+		entry.Checksum,
+	})
+}
+
+func (w *Writer) Flush() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// Manifest holds the entries of a manifest by path
+type Manifest struct {
+	entries map[string]Entry
+}
+
+func New() *Manifest {
+	return &Manifest{entries: make(map[string]Entry)}
+}
+
+// Read parses a manifest written by Writer. Columns are located by the header.
+func Read(r io.Reader) (*Manifest, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	fields, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range fields {
+		columns[name] = i
+	}
+	for _, name := range []string{PathColumn, ModeColumn, SizeColumn, ModTimeColumn} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("manifest header is missing the %s column", name)
+		}
+	}
+
+	m := New()
+	for line := 2; ; line++ {
+		fields, err = reader.Read()
+		if errors.Is(err, io.EOF) {
+			return m, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest: %w", err)
+		}
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return fields[i]
+		}
+		entry := Entry{
+			Path:              field(PathColumn),
+			ChecksumAlgorithm: field(ChecksumAlgorithmColumn),
+			Checksum:          field(ChecksumColumn),
+		}
+		if entry.Mode, err = listfile.ParseMode(field(ModeColumn)); err != nil {
+			return nil, fmt.Errorf("invalid manifest line %d: %v", line, err)
+		}
+		if entry.Size, err = strconv.ParseInt(field(SizeColumn), 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid manifest line %d: size %q", line, field(SizeColumn))
+		}
+		if entry.ModTime, err = time.Parse(time.RFC3339Nano, field(ModTimeColumn)); err != nil {
+			return nil, fmt.Errorf("invalid manifest line %d: mtime %q", line, field(ModTimeColumn))
+		}
+		if value := field(InodeColumn); len(value) > 0 {
+			if entry.Inode, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid manifest line %d: inode %q", line, value)
+			}
+		}
+		m.entries[entry.Path] = entry
+	}
+}
+
+// Add adds entry, replacing the entry of the same path
+func (m *Manifest) Add(entry Entry) {
+	m.entries[entry.Path] = entry
+}
+
+// Get returns the entry of path
+func (m *Manifest) Get(path string) (Entry, bool) {
+	entry, ok := m.entries[path]
+	return entry, ok
+}
+
+func (m *Manifest) Len() int {
+	return len(m.entries)
+}
+
+// Entries returns the entries sorted by path
+func (m *Manifest) Entries() []Entry {
+	entries := make([]Entry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// Compare returns how entry changed since the manifest, Added when the manifest lacks its path
+func (m *Manifest) Compare(entry Entry) string {
+	previous, ok := m.entries[entry.Path]
+	if !ok {
+		return Added
+	}
+	return previous.Compare(entry)
+}
+
+// Save writes the entries sorted by path
+func (m *Manifest) Save(w io.Writer) error {
+	writer, err := NewWriter(w)
+	if err != nil {
+		return err
+	}
+	for _, entry := range m.Entries() {
+		if err = writer.Write(entry); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,88 @@
+package manifest
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveRead_RoundTrip(t *testing.T) {
+	// given
+	m := New()
+	m.Add(Entry{Path: "b/with, comma.txt", Mode: 0644, Size: 12, ModTime: time.Date(2022, 3, 14, 12, 0, 0, 5, time.UTC), Inode: 42,
+		ChecksumAlgorithm: "xxhash", Checksum: "9a2c3f1e8b7d6054"})
+	m.Add(Entry{Path: "a", Mode: fs.ModeDir | 0755, ModTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Inode: 7})
+	builder := &strings.Builder{}
+
+	// when
+	require.NoError(t, m.Save(builder))
+	actual, err := Read(strings.NewReader(builder.String()))
+
+	// then
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(builder.String(), "path,mode,size,mtime,inode,checksum_algorithm,checksum\na,"))
+	require.Equal(t, 2, actual.Len())
+	for _, expected := range m.Entries() {
+		entry, ok := actual.Get(expected.Path)
+		require.True(t, ok)
+		assert.True(t, expected.ModTime.Equal(entry.ModTime))
+		entry.ModTime = expected.ModTime
+		assert.Equal(t, expected, entry)
+	}
+}
+
+func TestRead_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+	}{
+		{name: "missing column", manifest: "path,mode,size\na,-rw-r--r--,1\n"},
+		{name: "invalid mode", manifest: "path,mode,size,mtime\na,rw,1,2022-03-14T12:00:00Z\n"},
+		{name: "invalid size", manifest: "path,mode,size,mtime\na,-rw-r--r--,one,2022-03-14T12:00:00Z\n"},
+		{name: "invalid mtime", manifest: "path,mode,size,mtime\na,-rw-r--r--,1,yesterday\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// when
+			_, err := Read(strings.NewReader(test.manifest))
+
+			// then
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestManifest_Compare(t *testing.T) {
+	modTime := time.Date(2022, 3, 14, 12, 0, 0, 0, time.UTC)
+	m := New()
+	m.Add(Entry{Path: "file", Mode: 0644, Size: 4, ModTime: modTime, Inode: 1})
+	m.Add(Entry{Path: "dir", Mode: fs.ModeDir | 0755, ModTime: modTime, Inode: 2})
+
+	tests := []struct {
+		name     string
+		entry    Entry
+		expected string
+	}{
+		{name: "unchanged", entry: Entry{Path: "file", Mode: 0600, Size: 4, ModTime: modTime, Inode: 1}, expected: Unchanged},
+		{name: "new path", entry: Entry{Path: "other", Mode: 0644, Size: 4, ModTime: modTime}, expected: Added},
+		{name: "size", entry: Entry{Path: "file", Mode: 0644, Size: 5, ModTime: modTime, Inode: 1}, expected: Modified},
+		{name: "older mtime", entry: Entry{Path: "file", Mode: 0644, Size: 4, ModTime: modTime.Add(-time.Hour), Inode: 1}, expected: Modified},
+		{name: "replaced inode", entry: Entry{Path: "file", Mode: 0644, Size: 4, ModTime: modTime, Inode: 3}, expected: Modified},
+		{name: "unknown inode", entry: Entry{Path: "file", Mode: 0644, Size: 4, ModTime: modTime}, expected: Unchanged},
+		{name: "dir mtime", entry: Entry{Path: "dir", Mode: fs.ModeDir | 0755, ModTime: modTime.Add(time.Hour), Inode: 2}, expected: Unchanged},
+		{name: "file replaced by dir", entry: Entry{Path: "file", Mode: fs.ModeDir | 0755, ModTime: modTime, Inode: 1}, expected: Added},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// when
+			actual := m.Compare(test.entry)
+
+			// then
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package rberrors
+
+import "fmt"
+
+// ChecksumMismatchError reports a copy whose target content does not match the source digest, so it can be retried
+type ChecksumMismatchError struct {
+	Path           string
+	Algorithm      string
+	SourceChecksum string
+	TargetChecksum string
+}
+
+func (c ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch: %s %s source: %s target: %s", c.Path, c.Algorithm, c.SourceChecksum, c.TargetChecksum)
+}
@@ -0,0 +1,104 @@
+package tasks
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TempFileSuffix marks the hidden files a copy writes to before they are renamed into place
+const TempFileSuffix = ".rb-tmp"
+
+var tempNameRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+var tempNameRandLock sync.Mutex
+
+// tempFileName returns a random hidden temp file name beside dst, it is called by all copy workers concurrently
+func tempFileName(dir, base string) string {
+	tempNameRandLock.Lock()
+	n := tempNameRand.Uint32()
+	tempNameRandLock.Unlock()
+	return filepath.Join(dir, "."+base+"."+strconv.FormatUint(uint64(n), 10)+TempFileSuffix)
+}
+
+// createTempFile creates a hidden temp file beside dst.
+// Unlike os.CreateTemp it honors the umask, so the file gets the permissions os.Create would have given dst.
+func createTempFile(dst string) (*os.File, error) {
+	dir, base := filepath.Split(dst)
+	var err error
+	for i := 0; i < 10000; i++ {
+		name := tempFileName(dir, base)
+		var file *os.File
+		file, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		return file, err
+	}
+	return nil, err
+}
+
+// createTempLink creates a hidden link or node beside dst with link, named like the temp files of copies
+func createTempLink(dst string, link func(name string) error) (string, error) {
+	dir, base := filepath.Split(dst)
+	var err error
+	for i := 0; i < 10000; i++ {
+		name := tempFileName(dir, base)
+		err = link(name)
+		if os.IsExist(err) {
+			continue
+		}
+		return name, err
+	}
+	return "", err
+}
+
+// syncDir flushes a directory entry change such as a rename to stable storage.
+// Errors are ignored since not every platform allows syncing a directory.
+func syncDir(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	_ = dir.Sync()
+	_ = dir.Close()
+}
+
+func isTempFileName(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, TempFileSuffix)
+}
+
+// RemoveOrphanedTempFiles deletes temp files left in dir by copies that never reached their rename,
+// and the partial files and checkpoints of chunked copies that can never be resumed, e.g. as their source was deleted.
+// The subdirectories of dir are not visited, a dir that does not exist has nothing to remove.
+func RemoveOrphanedTempFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if !isTempFileName(entry.Name()) {
+			for _, orphan := range orphanedChunkedCopy(dir, entry.Name()) {
+				if err = os.Remove(orphan); err == nil {
+					removed = append(removed, orphan)
+				}
+			}
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if err = os.Remove(path); err == nil {
+			removed = append(removed, path)
+		}
+	}
+	return removed, nil
+}
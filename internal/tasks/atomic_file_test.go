@@ -0,0 +1,156 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFile_Do_LeavesNoTempFiles(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	srcFilePath := filepath.Join(srcRootPath, "test_file.txt")
+	require.NoError(t, os.WriteFile(srcFilePath, []byte("new content\n"), 0644))
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	targetFilePath := filepath.Join(targetRootPath, "test_file.txt")
+	require.NoError(t, os.WriteFile(targetFilePath, []byte("old content\n"), 0644))
+	testTask := BackupFileRequest{
+		CreationRequestTime: time.Now(),
+		SourcePath:          srcFilePath,
+		TargetPath:          targetFilePath,
+	}
+
+	// when
+	resp := testTask.Do()
+
+	// then
+	assert.True(t, resp.CompletionStatus)
+	data, err := os.ReadFile(targetFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, "new content\n", string(data))
+	entries, err := os.ReadDir(targetRootPath)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRemoveOrphanedTempFiles(t *testing.T) {
+	// given
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(targetRootPath, "one"), 0755))
+	keptPaths := []string{
+		filepath.Join(targetRootPath, "file.txt"),
+		filepath.Join(targetRootPath, ".hidden"),
+		filepath.Join(targetRootPath, "visible"+TempFileSuffix),
+		// subdirectories are swept on their own
+		filepath.Join(targetRootPath, "one", ".two.txt.456"+TempFileSuffix),
+	}
+	orphanPaths := []string{
+		filepath.Join(targetRootPath, ".file.txt.123"+TempFileSuffix),
+	}
+	for _, p := range append(keptPaths, orphanPaths...) {
+		require.NoError(t, os.WriteFile(p, []byte("data"), 0644))
+	}
+
+	// when
+	removed, err := RemoveOrphanedTempFiles(targetRootPath)
+
+	// then
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, orphanPaths, removed)
+	for _, p := range keptPaths {
+		assert.FileExists(t, p)
+	}
+	for _, p := range orphanPaths {
+		assert.NoFileExists(t, p)
+	}
+}
+
+func TestRemoveOrphanedTempFiles_ChunkedCopies(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	chunkedCopy := func(name, sourcePath string) {
+		dst := filepath.Join(targetRootPath, name)
+		require.NoError(t, os.WriteFile(partialFilePath(dst), []byte("data"), 0644))
+		checkpoint := &chunkCheckpoint{SourcePath: sourcePath, ChunkSize: 2, Chunks: []verifiedChunk{{Offset: 0, Length: 2}}}
+		require.NoError(t, checkpoint.save(checkpointFilePath(dst)))
+	}
+	existingSource := filepath.Join(srcRootPath, "kept.bin")
+	require.NoError(t, os.WriteFile(existingSource, []byte("data"), 0644))
+	chunkedCopy("kept.bin", existingSource)
+	chunkedCopy("deleted.bin", filepath.Join(srcRootPath, "deleted.bin"))
+	corruptCheckpoint := checkpointFilePath(filepath.Join(targetRootPath, "corrupt.bin"))
+	require.NoError(t, os.WriteFile(corruptCheckpoint, []byte("{"), 0644))
+	lonePartial := partialFilePath(filepath.Join(targetRootPath, "lone.bin"))
+	require.NoError(t, os.WriteFile(lonePartial, []byte("data"), 0644))
+	keptPaths := []string{
+		partialFilePath(filepath.Join(targetRootPath, "kept.bin")),
+		checkpointFilePath(filepath.Join(targetRootPath, "kept.bin")),
+	}
+	orphanPaths := []string{
+		partialFilePath(filepath.Join(targetRootPath, "deleted.bin")),
+		checkpointFilePath(filepath.Join(targetRootPath, "deleted.bin")),
+		corruptCheckpoint,
+		lonePartial,
+	}
+
+	// when
+	removed, err := RemoveOrphanedTempFiles(targetRootPath)
+
+	// then
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, orphanPaths, removed)
+	for _, p := range keptPaths {
+		assert.FileExists(t, p)
+	}
+	for _, p := range orphanPaths {
+		assert.NoFileExists(t, p)
+	}
+}
+
+func TestCreateTempFile_Concurrent(t *testing.T) {
+	// given
+	targetDir, err := os.MkdirTemp("", "tempFilesDir_*")
+	require.NoError(t, err)
+	dst := filepath.Join(targetDir, "file.txt")
+	const workers = 8
+	names := make(chan string, workers*10)
+	var wg sync.WaitGroup
+
+	// when
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				file, err := createTempFile(dst)
+				if !assert.NoError(t, err) {
+					return
+				}
+				names <- file.Name()
+				_ = file.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	close(names)
+
+	// then
+	unique := make(map[string]bool)
+	for name := range names {
+		assert.False(t, unique[name], name)
+		unique[name] = true
+		assert.True(t, isTempFileName(filepath.Base(name)), name)
+	}
+	assert.Len(t, unique, workers*10)
+}
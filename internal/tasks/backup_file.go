@@ -1,18 +1,49 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
+	"hash"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/rberrors"
+	"github.com/AppleGamer22/recursive-backup/internal/throttle"
 )
 
 type GeneralRequest interface{}
 
 type QuitRequest struct{}
 
+// CopyOptions holds the settings shared by all file copy requests of a run
+type CopyOptions struct {
+	Preserve          PreserveOptions
+	ChecksumAlgorithm string
+	// ChunkThreshold is the size from which files are copied in resumable chunks, zero disables chunked copies
+	ChunkThreshold int64
+	ChunkSize      int64
+	// Limiter throttles the reads of all copies sharing it, nil copies at full speed
+	Limiter *throttle.Limiter
+	// Symlinks is the policy for a source that is a symlink, empty means SymlinksSkip
+	Symlinks string
+	// HardLinks links the sources sharing an inode to the target of its first copy, nil copies every source
+	HardLinks *HardLinks
+	// Special is the policy for a source that is a FIFO, socket or device node, only SpecialRecreate backs it up
+	Special SpecialFilePolicy
+	// Sparse leaves the holes of a source as holes on the target instead of writing zeros
+	Sparse bool
+	// SparseZeroRuns also leaves the zero runs of at least 64KiB in the data of a source as holes with Sparse,
+	// for sources on filesystems that do not report their holes
+	SparseZeroRuns bool
+	// SkipUnchanged is the comparison of a source with its existing target that skips its copy, empty means SkipUnchangedNever
+	SkipUnchanged string
+	// LinkDest links the targets of unchanged sources to their copy in a previous backup, nil copies every source
+	LinkDest *LinkDest
+}
+
 type BackupFileRequest struct {
 	WorkerID            uint
 	FileID              uint
@@ -20,6 +51,7 @@ type BackupFileRequest struct {
 	CreationRequestTime time.Time
 	SourcePath          string
 	TargetPath          string
+	Options             CopyOptions
 	ResponseChannel     chan BackupFileResponse
 }
 
@@ -31,19 +63,76 @@ type BackupFileResponse struct {
 	CompletionTime      time.Time
 	SourcePath          string
 	TargetPath          string
-	CompletionStatus    bool
-	ErrorMessage        string
+	// Action is ActionCopy, ActionSymlink, ActionHardLink, ActionLinkDest or ActionSpecial
+	Action           string
+	CompletionStatus bool
+	// Skipped is set with CompletionStatus when the target was left as is since it matches the source, see SkipUnchangedSizeMTime
+	Skipped           bool
+	NotPreserved      []string
+	ChecksumAlgorithm string
+	SourceChecksum    string
+	TargetChecksum    string
+	Attempts          uint
+	// BytesCopied counts the bytes written by the successful attempt, a resumed chunked copy excludes the bytes copied before
+	BytesCopied int64
+	// LogicalBytes is the size of the copied file and PhysicalBytes the part of it holding data on the target, the rest being holes
+	LogicalBytes  int64
+	PhysicalBytes int64
+	Err           error
+	ErrorMessage  string
+}
+
+type copyResult struct {
+	BytesCopied       int64
+	LogicalBytes      int64
+	PhysicalBytes     int64
+	NotPreserved      []string
+	ChecksumAlgorithm string
+	SourceChecksum    string
+	TargetChecksum    string
 }
 
 func (b *BackupFileRequest) Do() BackupFileResponse {
+	return b.DoContext(context.Background())
+}
+
+// DoContext stops copying once ctx is done, removing the unfinished temp file so the target keeps its previous version
+func (b *BackupFileRequest) DoContext(ctx context.Context) BackupFileResponse {
+	// a source replaced by a symlink or a special file after it was listed gets its policy, follow copies what links point to
+	if info, err := b.statSource(); err == nil {
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			return b.doSymlink(ctx)
+		case isSpecial(info.Mode()):
+			request := BackupSpecialFileRequest(*b)
+			return request.DoContext(ctx)
+		}
+	}
+	if response, ok := b.doSkipUnchanged(ctx); ok {
+		return response
+	}
+	if b.Options.LinkDest != nil {
+		if response, ok := b.doLinkDest(ctx); ok {
+			return response
+		}
+	}
+	if b.Options.HardLinks != nil {
+		if response, ok := b.doHardLink(ctx); ok {
+			return response
+		}
+	}
+	return b.doCopy(ctx)
+}
+
+func (b *BackupFileRequest) doCopy(ctx context.Context) BackupFileResponse {
 	fmt.Printf(">>[w%d][b%d][f%d]>> cp %s -> %s\n", b.WorkerID, b.BatchID, b.FileID, b.SourcePath, b.TargetPath)
-	_, err := copyFile(b.SourcePath, b.TargetPath)
+	result, err := copyFile(ctx, b.SourcePath, b.TargetPath, b.Options)
 	switch err.(type) {
 	case *fs.PathError:
 		dirPath := filepath.Dir(b.TargetPath)
 		err = os.MkdirAll(dirPath, 0755)
 		if err == nil {
-			_, err = copyFile(b.SourcePath, b.TargetPath)
+			result, err = copyFile(ctx, b.SourcePath, b.TargetPath, b.Options)
 		}
 	}
 
@@ -55,7 +144,16 @@ func (b *BackupFileRequest) Do() BackupFileResponse {
 		CompletionTime:      time.Now(),
 		SourcePath:          b.SourcePath,
 		TargetPath:          b.TargetPath,
+		Action:              ActionCopy,
 		CompletionStatus:    err == nil,
+		Err:                 err,
+		NotPreserved:        result.NotPreserved,
+		ChecksumAlgorithm:   result.ChecksumAlgorithm,
+		SourceChecksum:      result.SourceChecksum,
+		TargetChecksum:      result.TargetChecksum,
+		BytesCopied:         result.BytesCopied,
+		LogicalBytes:        result.LogicalBytes,
+		PhysicalBytes:       result.PhysicalBytes,
 		ErrorMessage: func() string {
 			var val = "success"
 			if err != nil {
@@ -71,33 +169,165 @@ func (b *BackupFileRequest) Do() BackupFileResponse {
 	return response
 }
 
-func copyFile(src, dst string) (int64, error) {
+// statSource returns the info of the source as the symlink policy sees it
+func (b *BackupFileRequest) statSource() (fs.FileInfo, error) {
+	if b.Options.Symlinks == SymlinksFollow {
+		return os.Stat(b.SourcePath)
+	}
+	return os.Lstat(b.SourcePath)
+}
+
+// doSymlink recreates a symlink source with the copy-link policy and answers it as skipped with the skip policy,
+// e.g. a file replaced by a symlink after it was listed
+func (b *BackupFileRequest) doSymlink(ctx context.Context) BackupFileResponse {
+	if b.Options.Symlinks == SymlinksCopyLink {
+		request := BackupSymlinkRequest{
+			WorkerID:            b.WorkerID,
+			FileID:              b.FileID,
+			BatchID:             b.BatchID,
+			CreationRequestTime: b.CreationRequestTime,
+			SourcePath:          b.SourcePath,
+			TargetPath:          b.TargetPath,
+			Options:             b.Options,
+			ResponseChannel:     b.ResponseChannel,
+		}
+		return request.DoContext(ctx)
+	}
+	fmt.Printf("<<[w%d][b%d][f%d][skipped]<< cp %s -> %s is a symlink\n", b.WorkerID, b.BatchID, b.FileID, b.SourcePath, b.TargetPath)
+	return BackupFileResponse{
+		WorkerID:            b.WorkerID,
+		BatchID:             b.BatchID,
+		FileID:              b.FileID,
+		CreationRequestTime: b.CreationRequestTime,
+		CompletionTime:      time.Now(),
+		SourcePath:          b.SourcePath,
+		TargetPath:          b.TargetPath,
+		Action:              ActionSymlink,
+		CompletionStatus:    true,
+		Skipped:             true,
+		ErrorMessage:        fmt.Sprintf("skipped by symlinks policy %s", SymlinksSkip),
+	}
+}
+
+// Interrupt answers a request that was cancelled before it was copied
+func (b *BackupFileRequest) Interrupt(err error) BackupFileResponse {
+	return BackupFileResponse{
+		WorkerID:            b.WorkerID,
+		BatchID:             b.BatchID,
+		FileID:              b.FileID,
+		CreationRequestTime: b.CreationRequestTime,
+		CompletionTime:      time.Now(),
+		SourcePath:          b.SourcePath,
+		TargetPath:          b.TargetPath,
+		Action:              ActionCopy,
+		Err:                 err,
+		ErrorMessage:        fmt.Sprintf("copy interrupted: %v", err),
+	}
+}
+
+// copyFile copies src into a temp file beside dst, syncs it, applies the source metadata and renames it into place,
+// so dst is always either the previous version or the complete new one.
+// When a checksum algorithm is selected, the source is hashed while streaming and the temp file is re-read before the rename.
+func copyFile(ctx context.Context, src, dst string, opts CopyOptions) (result copyResult, err error) {
 	sourceFileStat, err := os.Stat(src)
 	if err != nil {
-		return 0, err
+		return result, err
 	}
 
 	if !sourceFileStat.Mode().IsRegular() {
-		return 0, fmt.Errorf("%s is not a regular file", src)
+		return result, fmt.Errorf("%s is not a regular file", src)
+	}
+
+	if opts.ChunkThreshold > 0 && opts.ChunkSize > 0 && sourceFileStat.Size() >= opts.ChunkThreshold {
+		return copyFileInChunks(ctx, src, dst, sourceFileStat, opts)
 	}
 
 	source, err := os.Open(src)
 	if err != nil {
-		return 0, err
+		return result, err
 	}
 	defer func() {
 		_ = source.Close()
 	}()
 
-	destination, err := os.Create(dst)
+	var sourceHash hash.Hash
+	if isChecksumEnabled(opts.ChecksumAlgorithm) {
+		if sourceHash, err = newHash(opts.ChecksumAlgorithm); err != nil {
+			return result, err
+		}
+	}
+
+	destination, err := createTempFile(dst)
 	if err != nil {
-		return 0, err
+		return result, err
 	}
+	tempPath := destination.Name()
 	defer func() {
-		_ = destination.Close()
+		if err != nil {
+			_ = os.Remove(tempPath)
+		}
 	}()
 
-	nBytes, err := io.Copy(destination, source)
+	result.BytesCopied, err = copyContents(ctx, source, destination, sourceFileStat.Size(), sourceHash, opts)
+	if err == nil {
+		err = destination.Sync()
+	}
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return result, err
+	}
 
-	return nBytes, err
+	if sourceHash != nil {
+		result.ChecksumAlgorithm = opts.ChecksumAlgorithm
+		result.SourceChecksum = digest(sourceHash)
+		if result.TargetChecksum, err = fileChecksum(tempPath, opts.ChecksumAlgorithm); err != nil {
+			return result, err
+		}
+		if result.SourceChecksum != result.TargetChecksum {
+			return result, rberrors.ChecksumMismatchError{
+				Path:           dst,
+				Algorithm:      opts.ChecksumAlgorithm,
+				SourceChecksum: result.SourceChecksum,
+				TargetChecksum: result.TargetChecksum,
+			}
+		}
+	}
+
+	result.NotPreserved = preserveMetadata(tempPath, sourceFileStat, opts.Preserve)
+	if err = os.Rename(tempPath, dst); err != nil {
+		return result, err
+	}
+	syncDir(filepath.Dir(dst))
+	result.LogicalBytes = sourceFileStat.Size()
+	result.PhysicalBytes = physicalBytes(dst, sourceFileStat.Size())
+
+	return result, nil
+}
+
+// copyContents copies size bytes of source to destination, sparsely with opts.Sparse, writing them to sourceHash if it is set
+func copyContents(ctx context.Context, source, destination *os.File, size int64, sourceHash hash.Hash, opts CopyOptions) (int64, error) {
+	var h io.Writer
+	if sourceHash != nil {
+		h = sourceHash
+	}
+	extents, sparse, err := sparseExtents(source, 0, size, opts)
+	if err != nil {
+		return 0, err
+	}
+	if sparse {
+		return copySparseRange(ctx, source, destination, extents, 0, size, opts, h)
+	}
+	if opts.Sparse {
+		// looking for the holes moved the offset of source
+		if _, err = source.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	reader := throttle.NewReader(ctx, newContextReader(ctx, source), opts.Limiter)
+	if h != nil {
+		reader = io.TeeReader(reader, h)
+	}
+	return io.Copy(destination, reader)
 }
@@ -0,0 +1,206 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// SpecialSkip leaves special files out of the backup, only counting them in the list errors file
+	SpecialSkip = "skip"
+	// SpecialReport lists special files in the special files list without backing them up
+	SpecialReport = "report"
+	// SpecialRecreate lists special files in the special files list and recreates them on the target with mknod,
+	// which requires root for device nodes
+	SpecialRecreate = "recreate"
+)
+
+const (
+	SpecialFIFO   = "fifo"
+	SpecialSocket = "socket"
+	SpecialDevice = "device"
+)
+
+// ActionSpecial is the action of a response whose special file was recreated on the target
+const ActionSpecial = "special"
+
+// SpecialFilePolicy is the policy of each special file type, an empty policy means SpecialReport
+type SpecialFilePolicy struct {
+	FIFO   string
+	Socket string
+	Device string
+}
+
+// ParseSpecialFilePolicy parses a comma separated list of policies. A bare policy applies to every type
+// and a type=policy item to fifo, socket or device only, e.g. "skip,fifo=recreate".
+func ParseSpecialFilePolicy(s string) (SpecialFilePolicy, error) {
+	var out SpecialFilePolicy
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		kind, policy := "", item
+		if i := strings.Index(item, "="); i >= 0 {
+			kind, policy = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		switch policy {
+		case SpecialSkip, SpecialReport, SpecialRecreate:
+		default:
+			return SpecialFilePolicy{}, fmt.Errorf("unknown special files policy %q, expecting %s, %s or %s", policy, SpecialSkip, SpecialReport, SpecialRecreate)
+		}
+		switch kind {
+		case "":
+			out = SpecialFilePolicy{FIFO: policy, Socket: policy, Device: policy}
+		case SpecialFIFO:
+			out.FIFO = policy
+		case SpecialSocket:
+			out.Socket = policy
+		case SpecialDevice:
+			out.Device = policy
+		default:
+			return SpecialFilePolicy{}, fmt.Errorf("unknown special file type %q, expecting %s, %s or %s", kind, SpecialFIFO, SpecialSocket, SpecialDevice)
+		}
+	}
+	return out, nil
+}
+
+func (p SpecialFilePolicy) String() string {
+	return fmt.Sprintf("%s=%s,%s=%s,%s=%s", SpecialFIFO, p.policy(p.FIFO), SpecialSocket, p.policy(p.Socket), SpecialDevice, p.policy(p.Device))
+}
+
+func (p SpecialFilePolicy) policy(policy string) string {
+	if len(policy) == 0 {
+		return SpecialReport
+	}
+	return policy
+}
+
+// Recreates reports whether any special file type is recreated
+func (p SpecialFilePolicy) Recreates() bool {
+	return p.FIFO == SpecialRecreate || p.Socket == SpecialRecreate || p.Device == SpecialRecreate
+}
+
+// For returns the special file type of mode and its policy, or an empty type when mode is not a special file
+func (p SpecialFilePolicy) For(mode fs.FileMode) (kind, policy string) {
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		return SpecialFIFO, p.policy(p.FIFO)
+	case mode&fs.ModeSocket != 0:
+		return SpecialSocket, p.policy(p.Socket)
+	case mode&fs.ModeDevice != 0:
+		return SpecialDevice, p.policy(p.Device)
+	default:
+		return "", ""
+	}
+}
+
+// BackupSpecialFileRequest recreates the FIFO, socket or device node at SourcePath on TargetPath
+type BackupSpecialFileRequest struct {
+	WorkerID            uint
+	FileID              uint
+	BatchID             uint
+	CreationRequestTime time.Time
+	SourcePath          string
+	TargetPath          string
+	Options             CopyOptions
+	ResponseChannel     chan BackupFileResponse
+}
+
+func (b *BackupSpecialFileRequest) Do() BackupFileResponse {
+	return b.DoContext(context.Background())
+}
+
+// DoContext creates the node beside the target and renames it into place, so the target is replaced atomically.
+// A socket node only keeps the path of the socket, nothing listens on it until its program binds it again.
+func (b *BackupSpecialFileRequest) DoContext(ctx context.Context) BackupFileResponse {
+	fmt.Printf(">>[w%d][b%d][f%d]>> mknod %s -> %s\n", b.WorkerID, b.BatchID, b.FileID, b.SourcePath, b.TargetPath)
+	var notPreserved []string
+	err := ctx.Err()
+	if err == nil {
+		notPreserved, err = copySpecialFile(b.SourcePath, b.TargetPath, b.Options)
+	}
+
+	response := BackupFileResponse{
+		WorkerID:            b.WorkerID,
+		BatchID:             b.BatchID,
+		FileID:              b.FileID,
+		CreationRequestTime: b.CreationRequestTime,
+		CompletionTime:      time.Now(),
+		SourcePath:          b.SourcePath,
+		TargetPath:          b.TargetPath,
+		Action:              ActionSpecial,
+		CompletionStatus:    err == nil,
+		Err:                 err,
+		NotPreserved:        notPreserved,
+		ErrorMessage:        "success",
+	}
+	if err != nil {
+		response.ErrorMessage = err.Error()
+	}
+
+	fmt.Printf("<<[w%d][b%d][f%d][%t]<< mknod %s -> %s\n", b.WorkerID,
+		b.BatchID, b.FileID, response.CompletionStatus, b.SourcePath, b.TargetPath)
+
+	return response
+}
+
+// Interrupt answers a request that was cancelled before the node was created
+func (b *BackupSpecialFileRequest) Interrupt(err error) BackupFileResponse {
+	return BackupFileResponse{
+		WorkerID:            b.WorkerID,
+		BatchID:             b.BatchID,
+		FileID:              b.FileID,
+		CreationRequestTime: b.CreationRequestTime,
+		CompletionTime:      time.Now(),
+		SourcePath:          b.SourcePath,
+		TargetPath:          b.TargetPath,
+		Action:              ActionSpecial,
+		Err:                 err,
+		ErrorMessage:        fmt.Sprintf("copy interrupted: %v", err),
+	}
+}
+
+func copySpecialFile(src, dst string, opts CopyOptions) ([]string, error) {
+	info, err := os.Lstat(src)
+	if opts.Symlinks == SymlinksFollow {
+		info, err = os.Stat(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	kind, policy := opts.Special.For(info.Mode())
+	if len(kind) == 0 {
+		return nil, fmt.Errorf("%s is not a special file", src)
+	}
+	if policy != SpecialRecreate {
+		return nil, fmt.Errorf("%s is a %s, not recreated by the %s special files policy", src, kind, policy)
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return nil, err
+	}
+	tempPath, err := createTempLink(dst, func(name string) error {
+		return mknod(name, info)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notPreserved := preserveMetadata(tempPath, info, opts.Preserve)
+	if err = os.Rename(tempPath, dst); err != nil {
+		_ = os.Remove(tempPath)
+		return notPreserved, err
+	}
+	syncDir(filepath.Dir(dst))
+	return notPreserved, nil
+}
+
+// isSpecial reports whether mode is a FIFO, socket or device node
+func isSpecial(mode fs.FileMode) bool {
+	return mode&(fs.ModeNamedPipe|fs.ModeSocket|fs.ModeDevice) != 0
+}
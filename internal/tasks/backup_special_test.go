@@ -0,0 +1,56 @@
+package tasks
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSpecialFilePolicy(t *testing.T) {
+	testCases := []struct {
+		input       string
+		expected    SpecialFilePolicy
+		expectedErr bool
+	}{
+		{input: "", expected: SpecialFilePolicy{}},
+		{input: SpecialSkip, expected: SpecialFilePolicy{FIFO: SpecialSkip, Socket: SpecialSkip, Device: SpecialSkip}},
+		{input: "skip,fifo=recreate", expected: SpecialFilePolicy{FIFO: SpecialRecreate, Socket: SpecialSkip, Device: SpecialSkip}},
+		{input: "device=recreate, socket=skip", expected: SpecialFilePolicy{Socket: SpecialSkip, Device: SpecialRecreate}},
+		{input: "copy", expectedErr: true},
+		{input: "pipe=skip", expectedErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			// when
+			policy, err := ParseSpecialFilePolicy(tc.input)
+
+			// then
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, policy)
+		})
+	}
+}
+
+func TestSpecialFilePolicy_For(t *testing.T) {
+	// given
+	policy := SpecialFilePolicy{FIFO: SpecialRecreate, Socket: SpecialSkip}
+
+	// when, then
+	for mode, expected := range map[fs.FileMode][2]string{
+		fs.ModeNamedPipe:                  {SpecialFIFO, SpecialRecreate},
+		fs.ModeSocket:                     {SpecialSocket, SpecialSkip},
+		fs.ModeDevice | fs.ModeCharDevice: {SpecialDevice, SpecialReport},
+		0:                                 {"", ""},
+		fs.ModeIrregular:                  {"", ""},
+	} {
+		kind, p := policy.For(mode)
+		assert.Equal(t, expected, [2]string{kind, p}, mode.String())
+	}
+	assert.Equal(t, "fifo=recreate,socket=skip,device=report", policy.String())
+	assert.True(t, policy.Recreates())
+}
@@ -0,0 +1,140 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// SymlinksSkip leaves symlinks out of the backup, noting them in the list errors file only
+	SymlinksSkip = "skip"
+	// SymlinksCopyLink recreates symlinks on the target with the same, unresolved, link target
+	SymlinksCopyLink = "copy-link"
+	// SymlinksFollow backs up what symlinks point to as if it was at the link's path, walking linked directories
+	SymlinksFollow = "follow"
+)
+
+const (
+	// ActionCopy is the action of a response whose file contents were copied
+	ActionCopy = "copy"
+	// ActionSymlink is the action of a response whose symlink was recreated on the target
+	ActionSymlink = "symlink"
+)
+
+// ValidateSymlinks validates a symlink policy, empty means SymlinksSkip
+func ValidateSymlinks(policy string) error {
+	switch policy {
+	case "", SymlinksSkip, SymlinksCopyLink, SymlinksFollow:
+		return nil
+	default:
+		return fmt.Errorf("unknown symlinks policy %q, expecting %s, %s or %s", policy, SymlinksSkip, SymlinksCopyLink, SymlinksFollow)
+	}
+}
+
+func isSymlink(d fs.DirEntry) bool {
+	return d.Type()&fs.ModeSymlink != 0
+}
+
+// BackupSymlinkRequest recreates the symlink at SourcePath on TargetPath, keeping its link target as is
+type BackupSymlinkRequest struct {
+	WorkerID            uint
+	FileID              uint
+	BatchID             uint
+	CreationRequestTime time.Time
+	SourcePath          string
+	TargetPath          string
+	Options             CopyOptions
+	ResponseChannel     chan BackupFileResponse
+}
+
+func (b *BackupSymlinkRequest) Do() BackupFileResponse {
+	return b.DoContext(context.Background())
+}
+
+// DoContext creates the link beside the target and renames it into place, so the target is replaced atomically.
+// Only ownership is preserved, since the mode and timestamps of a symlink cannot be set portably.
+func (b *BackupSymlinkRequest) DoContext(ctx context.Context) BackupFileResponse {
+	fmt.Printf(">>[w%d][b%d][f%d]>> ln %s -> %s\n", b.WorkerID, b.BatchID, b.FileID, b.SourcePath, b.TargetPath)
+	var notPreserved []string
+	err := ctx.Err()
+	if err == nil {
+		notPreserved, err = copySymlink(b.SourcePath, b.TargetPath, b.Options)
+	}
+
+	response := BackupFileResponse{
+		WorkerID:            b.WorkerID,
+		BatchID:             b.BatchID,
+		FileID:              b.FileID,
+		CreationRequestTime: b.CreationRequestTime,
+		CompletionTime:      time.Now(),
+		SourcePath:          b.SourcePath,
+		TargetPath:          b.TargetPath,
+		Action:              ActionSymlink,
+		CompletionStatus:    err == nil,
+		Err:                 err,
+		NotPreserved:        notPreserved,
+		ErrorMessage:        "success",
+	}
+	if err != nil {
+		response.ErrorMessage = err.Error()
+	}
+
+	fmt.Printf("<<[w%d][b%d][f%d][%t]<< ln %s -> %s\n", b.WorkerID,
+		b.BatchID, b.FileID, response.CompletionStatus, b.SourcePath, b.TargetPath)
+
+	return response
+}
+
+// Interrupt answers a request that was cancelled before the link was created
+func (b *BackupSymlinkRequest) Interrupt(err error) BackupFileResponse {
+	return BackupFileResponse{
+		WorkerID:            b.WorkerID,
+		BatchID:             b.BatchID,
+		FileID:              b.FileID,
+		CreationRequestTime: b.CreationRequestTime,
+		CompletionTime:      time.Now(),
+		SourcePath:          b.SourcePath,
+		TargetPath:          b.TargetPath,
+		Action:              ActionSymlink,
+		Err:                 err,
+		ErrorMessage:        fmt.Sprintf("copy interrupted: %v", err),
+	}
+}
+
+func copySymlink(src, dst string, opts CopyOptions) ([]string, error) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return nil, fmt.Errorf("%s is not a symlink", src)
+	}
+	linkTarget, err := os.Readlink(src)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return nil, err
+	}
+	tempPath, err := createTempLink(dst, func(name string) error {
+		return os.Symlink(linkTarget, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var notPreserved []string
+	if opts.Preserve.Ownership {
+		notPreserved = preserveMetadata(tempPath, info, PreserveOptions{Ownership: true})
+	}
+	if err = os.Rename(tempPath, dst); err != nil {
+		_ = os.Remove(tempPath)
+		return notPreserved, err
+	}
+	syncDir(filepath.Dir(dst))
+	return notPreserved, nil
+}
@@ -0,0 +1,85 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupSymlinkRequest_Do(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires a privilege on windows")
+	}
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	require.NoError(t, os.Symlink(filepath.Join("..", "elsewhere"), filepath.Join(srcRootPath, "link")))
+	targetPath := filepath.Join(targetRootPath, "one", "link")
+	request := BackupSymlinkRequest{SourcePath: filepath.Join(srcRootPath, "link"), TargetPath: targetPath}
+
+	// when
+	response := request.Do()
+
+	// then
+	assert.True(t, response.CompletionStatus)
+	assert.Equal(t, ActionSymlink, response.Action)
+	linkTarget, err := os.Readlink(targetPath)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("..", "elsewhere"), linkTarget)
+}
+
+func TestBackupFileRequest_Do_SymlinkSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires a privilege on windows")
+	}
+	testCases := []struct {
+		symlinks        string
+		expectedSkipped bool
+		expectedAction  string
+		expectedLink    bool
+	}{
+		{symlinks: SymlinksSkip, expectedSkipped: true, expectedAction: ActionSymlink},
+		{symlinks: SymlinksCopyLink, expectedAction: ActionSymlink, expectedLink: true},
+		{symlinks: SymlinksFollow, expectedAction: ActionCopy},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.symlinks, func(t *testing.T) {
+			// given
+			srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+			require.NoError(t, err)
+			targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(filepath.Join(srcRootPath, "file.txt"), []byte("data"), 0644))
+			require.NoError(t, os.Symlink("file.txt", filepath.Join(srcRootPath, "link")))
+			targetPath := filepath.Join(targetRootPath, "link")
+			request := BackupFileRequest{
+				SourcePath: filepath.Join(srcRootPath, "link"),
+				TargetPath: targetPath,
+				Options:    CopyOptions{Symlinks: tc.symlinks},
+			}
+
+			// when
+			response := request.Do()
+
+			// then
+			assert.True(t, response.CompletionStatus, response.ErrorMessage)
+			assert.Equal(t, tc.expectedSkipped, response.Skipped)
+			assert.Equal(t, tc.expectedAction, response.Action)
+			info, err := os.Lstat(targetPath)
+			if tc.expectedSkipped {
+				assert.NoError(t, response.Err)
+				assert.Equal(t, "skipped by symlinks policy skip", response.ErrorMessage)
+				assert.True(t, os.IsNotExist(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedLink, info.Mode()&os.ModeSymlink != 0)
+		})
+	}
+}
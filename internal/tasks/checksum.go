@@ -0,0 +1,71 @@
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/cespare/xxhash/v2"
+	"lukechampine.com/blake3"
+)
+
+const (
+	ChecksumNone   = "none"
+	ChecksumSHA256 = "sha256"
+	ChecksumBLAKE3 = "blake3"
+	ChecksumXXHash = "xxhash"
+)
+
+// ValidateChecksumAlgorithm accepts an empty value, none, sha256, blake3 or xxhash
+func ValidateChecksumAlgorithm(algorithm string) error {
+	switch algorithm {
+	case "", ChecksumNone, ChecksumSHA256, ChecksumBLAKE3, ChecksumXXHash:
+		return nil
+	default:
+		return fmt.Errorf("unknown checksum algorithm %q, expecting one of %s, %s, %s or %s",
+			algorithm, ChecksumNone, ChecksumSHA256, ChecksumBLAKE3, ChecksumXXHash)
+	}
+}
+
+func isChecksumEnabled(algorithm string) bool {
+	return algorithm != "" && algorithm != ChecksumNone
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumBLAKE3:
+		return blake3.New(32, nil), nil
+	case ChecksumXXHash:
+		return xxhash.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+}
+
+func digest(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fileChecksum reads path from the start and returns its hex encoded digest
+func fileChecksum(path, algorithm string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if _, err = io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return digest(h), nil
+}
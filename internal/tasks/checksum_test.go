@@ -0,0 +1,73 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateChecksumAlgorithm(t *testing.T) {
+	for _, algorithm := range []string{"", ChecksumNone, ChecksumSHA256, ChecksumBLAKE3, ChecksumXXHash} {
+		assert.NoError(t, ValidateChecksumAlgorithm(algorithm), algorithm)
+	}
+	assert.Error(t, ValidateChecksumAlgorithm("md5"))
+}
+
+func TestBackupFile_Do_Checksum(t *testing.T) {
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	srcFilePath := filepath.Join(srcRootPath, "test_file.txt")
+	require.NoError(t, os.WriteFile(srcFilePath, []byte("testing123\n"), 0644))
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		algorithm        string
+		expectedChecksum string
+	}{
+		{
+			algorithm:        ChecksumSHA256,
+			expectedChecksum: "d3e54e9d6814999b722fcf9fce64511c16558825fff8d344cb177cafae6e87a3",
+		}, {
+			algorithm: ChecksumBLAKE3,
+		}, {
+			algorithm: ChecksumXXHash,
+		}, {
+			algorithm: ChecksumNone,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			// given
+			targetFilePath := filepath.Join(targetRootPath, tc.algorithm)
+			testTask := BackupFileRequest{
+				CreationRequestTime: time.Now(),
+				SourcePath:          srcFilePath,
+				TargetPath:          targetFilePath,
+				Options:             CopyOptions{ChecksumAlgorithm: tc.algorithm},
+			}
+
+			// when
+			resp := testTask.Do()
+
+			// then
+			assert.True(t, resp.CompletionStatus, resp.ErrorMessage)
+			assert.Equal(t, resp.SourceChecksum, resp.TargetChecksum)
+			if tc.algorithm == ChecksumNone {
+				assert.Empty(t, resp.ChecksumAlgorithm)
+				assert.Empty(t, resp.SourceChecksum)
+				return
+			}
+			assert.Equal(t, tc.algorithm, resp.ChecksumAlgorithm)
+			assert.NotEmpty(t, resp.SourceChecksum)
+			if tc.expectedChecksum != "" {
+				assert.Equal(t, tc.expectedChecksum, resp.SourceChecksum)
+			}
+		})
+	}
+}
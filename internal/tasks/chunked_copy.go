@@ -0,0 +1,289 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/rberrors"
+	"github.com/AppleGamer22/recursive-backup/internal/throttle"
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	// PartialFileSuffix marks the hidden file a chunked copy writes to until all of its chunks are verified
+	PartialFileSuffix = ".rb-partial"
+	// CheckpointFileSuffix marks the sidecar recording the verified chunks of a partial file
+	CheckpointFileSuffix = ".rb-checkpoint"
+	// chunkChecksumAlgorithm verifies every written chunk, independently of the whole file checksum option
+	chunkChecksumAlgorithm = ChecksumXXHash
+)
+
+type chunkCheckpoint struct {
+	SourcePath    string          `json:"source_path"`
+	SourceSize    int64           `json:"source_size"`
+	SourceModTime time.Time       `json:"source_mod_time"`
+	ChunkSize     int64           `json:"chunk_size"`
+	Chunks        []verifiedChunk `json:"chunks"`
+}
+
+type verifiedChunk struct {
+	Offset   int64  `json:"offset"`
+	Length   int64  `json:"length"`
+	Checksum string `json:"checksum"`
+}
+
+func partialFilePath(dst string) string {
+	dir, base := filepath.Split(dst)
+	return filepath.Join(dir, "."+base+PartialFileSuffix)
+}
+
+func checkpointFilePath(dst string) string {
+	dir, base := filepath.Split(dst)
+	return filepath.Join(dir, "."+base+CheckpointFileSuffix)
+}
+
+// removeChunkedCopySidecars removes the partial file and the checkpoint of a chunked copy to dst
+func removeChunkedCopySidecars(dst string) {
+	_ = os.Remove(partialFilePath(dst))
+	_ = os.Remove(checkpointFilePath(dst))
+}
+
+// orphanedChunkedCopy returns the sidecars of a chunked copy left in dir that can never be resumed, when name is
+// the partial file or the checkpoint of one: a partial file without its checkpoint, or a checkpoint that cannot be
+// read or whose source no longer exists, together with its partial file
+func orphanedChunkedCopy(dir, name string) []string {
+	if !strings.HasPrefix(name, ".") {
+		return nil
+	}
+	switch {
+	case strings.HasSuffix(name, PartialFileSuffix):
+		dst := filepath.Join(dir, strings.TrimSuffix(name[1:], PartialFileSuffix))
+		if _, err := os.Lstat(checkpointFilePath(dst)); os.IsNotExist(err) {
+			return []string{partialFilePath(dst)}
+		}
+	case strings.HasSuffix(name, CheckpointFileSuffix):
+		dst := filepath.Join(dir, strings.TrimSuffix(name[1:], CheckpointFileSuffix))
+		checkpoint, err := loadCheckpoint(checkpointFilePath(dst))
+		if err == nil {
+			_, err = os.Lstat(checkpoint.SourcePath)
+		}
+		if err != nil && !os.IsPermission(err) {
+			return []string{checkpointFilePath(dst), partialFilePath(dst)}
+		}
+	}
+	return nil
+}
+
+func (c *chunkCheckpoint) matches(src string, srcInfo fs.FileInfo, chunkSize int64) bool {
+	return c.SourcePath == src && c.SourceSize == srcInfo.Size() && c.SourceModTime.Equal(srcInfo.ModTime()) && c.ChunkSize == chunkSize
+}
+
+// verifiedLength returns the length of the contiguous verified prefix of the partial file
+func (c *chunkCheckpoint) verifiedLength() int64 {
+	var length int64
+	for _, chunk := range c.Chunks {
+		if chunk.Offset != length {
+			break
+		}
+		length += chunk.Length
+	}
+	return length
+}
+
+func loadCheckpoint(path string) (*chunkCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &chunkCheckpoint{}
+	if err = json.Unmarshal(data, checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// save replaces the checkpoint file through a synced temp file, so a crash never leaves a truncated checkpoint
+func (c *chunkCheckpoint) save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	file, err := createTempFile(path)
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tempPath)
+	}
+	return err
+}
+
+// copyFileInChunks copies src in fixed size chunks into a partial file beside dst.
+// Every chunk is re-read and verified after it is synced, and its offset is recorded in a checkpoint sidecar,
+// so a later copy of the same unchanged source continues from the last verified chunk, also after ctx stopped it.
+func copyFileInChunks(ctx context.Context, src, dst string, srcInfo fs.FileInfo, opts CopyOptions) (result copyResult, err error) {
+	partialPath := partialFilePath(dst)
+	checkpointPath := checkpointFilePath(dst)
+
+	var offset int64
+	checkpoint, loadErr := loadCheckpoint(checkpointPath)
+	partialInfo, statErr := os.Stat(partialPath)
+	if loadErr == nil && statErr == nil && checkpoint.matches(src, srcInfo, opts.ChunkSize) && partialInfo.Size() >= checkpoint.verifiedLength() {
+		offset = checkpoint.verifiedLength()
+		fmt.Printf("resuming %s from offset %d\n", dst, offset)
+	} else {
+		if loadErr == nil || statErr == nil {
+			// a partial copy of another source or another version of it can never be resumed
+			removeChunkedCopySidecars(dst)
+		}
+		checkpoint = &chunkCheckpoint{
+			SourcePath:    src,
+			SourceSize:    srcInfo.Size(),
+			SourceModTime: srcInfo.ModTime(),
+			ChunkSize:     opts.ChunkSize,
+		}
+	}
+	checkpoint.Chunks = trimChunks(checkpoint.Chunks, offset)
+	result.BytesCopied = srcInfo.Size() - offset
+
+	source, err := os.Open(src)
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	partial, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		_ = partial.Close()
+	}()
+	if err = partial.Truncate(offset); err != nil {
+		return result, err
+	}
+
+	for offset < srcInfo.Size() {
+		length := opts.ChunkSize
+		if remaining := srcInfo.Size() - offset; remaining < length {
+			length = remaining
+		}
+		var chunk verifiedChunk
+		if chunk, err = copyChunk(ctx, source, partial, offset, length, opts); err != nil {
+			_ = partial.Truncate(offset)
+			return result, err
+		}
+		checkpoint.Chunks = append(checkpoint.Chunks, chunk)
+		if err = checkpoint.save(checkpointPath); err != nil {
+			return result, err
+		}
+		offset += length
+	}
+	if err = partial.Close(); err != nil {
+		return result, err
+	}
+
+	if isChecksumEnabled(opts.ChecksumAlgorithm) {
+		result.ChecksumAlgorithm = opts.ChecksumAlgorithm
+		if result.SourceChecksum, err = fileChecksum(src, opts.ChecksumAlgorithm); err != nil {
+			return result, err
+		}
+		if result.TargetChecksum, err = fileChecksum(partialPath, opts.ChecksumAlgorithm); err != nil {
+			return result, err
+		}
+		if result.SourceChecksum != result.TargetChecksum {
+			_ = os.Remove(partialPath)
+			_ = os.Remove(checkpointPath)
+			return result, rberrors.ChecksumMismatchError{
+				Path:           dst,
+				Algorithm:      opts.ChecksumAlgorithm,
+				SourceChecksum: result.SourceChecksum,
+				TargetChecksum: result.TargetChecksum,
+			}
+		}
+	}
+
+	result.NotPreserved = preserveMetadata(partialPath, srcInfo, opts.Preserve)
+	if err = os.Rename(partialPath, dst); err != nil {
+		return result, err
+	}
+	_ = os.Remove(checkpointPath)
+	syncDir(filepath.Dir(dst))
+	result.LogicalBytes = srcInfo.Size()
+	result.PhysicalBytes = physicalBytes(dst, srcInfo.Size())
+
+	return result, nil
+}
+
+// copyChunk copies length bytes at offset from source into partial, syncs them and verifies them by reading them back.
+// With opts.Sparse the holes of the chunk, and its long zero runs with opts.SparseZeroRuns, are left as holes in partial.
+func copyChunk(ctx context.Context, source, partial *os.File, offset, length int64, opts CopyOptions) (verifiedChunk, error) {
+	chunk := verifiedChunk{Offset: offset, Length: length}
+	sourceHash := xxhash.New()
+	extents, sparse, err := sparseExtents(source, offset, length, opts)
+	if err != nil {
+		return chunk, err
+	}
+	if sparse {
+		if _, err := copySparseRange(ctx, source, partial, extents, offset, length, opts, sourceHash); err != nil {
+			return chunk, err
+		}
+	} else {
+		sectionReader := newContextReader(ctx, io.NewSectionReader(source, offset, length))
+		sourceReader := io.TeeReader(throttle.NewReader(ctx, sectionReader, opts.Limiter), sourceHash)
+		if _, err := partial.Seek(offset, io.SeekStart); err != nil {
+			return chunk, err
+		}
+		if _, err := io.CopyN(partial, sourceReader, length); err != nil {
+			return chunk, err
+		}
+	}
+	if err := partial.Sync(); err != nil {
+		return chunk, err
+	}
+
+	targetHash := xxhash.New()
+	if _, err := io.Copy(targetHash, io.NewSectionReader(partial, offset, length)); err != nil {
+		return chunk, err
+	}
+	chunk.Checksum = digest(sourceHash)
+	if targetChecksum := digest(targetHash); targetChecksum != chunk.Checksum {
+		return chunk, rberrors.ChecksumMismatchError{
+			Path:           partial.Name(),
+			Algorithm:      chunkChecksumAlgorithm,
+			SourceChecksum: chunk.Checksum,
+			TargetChecksum: targetChecksum,
+		}
+	}
+	return chunk, nil
+}
+
+func trimChunks(chunks []verifiedChunk, length int64) []verifiedChunk {
+	var out []verifiedChunk
+	for _, chunk := range chunks {
+		if chunk.Offset+chunk.Length <= length {
+			out = append(out, chunk)
+		}
+	}
+	return out
+}
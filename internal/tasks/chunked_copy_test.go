@@ -0,0 +1,135 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFile_Do_Chunked(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	srcFilePath := filepath.Join(srcRootPath, "large_file.bin")
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	require.NoError(t, os.WriteFile(srcFilePath, content, 0644))
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	targetFilePath := filepath.Join(targetRootPath, "large_file.bin")
+	testTask := BackupFileRequest{
+		CreationRequestTime: time.Now(),
+		SourcePath:          srcFilePath,
+		TargetPath:          targetFilePath,
+		Options: CopyOptions{
+			ChecksumAlgorithm: ChecksumSHA256,
+			ChunkThreshold:    16,
+			ChunkSize:         5,
+		},
+	}
+
+	// when
+	resp := testTask.Do()
+
+	// then
+	assert.True(t, resp.CompletionStatus, resp.ErrorMessage)
+	assert.Equal(t, resp.SourceChecksum, resp.TargetChecksum)
+	data, err := os.ReadFile(targetFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+	assert.NoFileExists(t, partialFilePath(targetFilePath))
+	assert.NoFileExists(t, checkpointFilePath(targetFilePath))
+}
+
+func TestBackupFile_Do_ChunkedResume(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	srcFilePath := filepath.Join(srcRootPath, "large_file.bin")
+	require.NoError(t, os.WriteFile(srcFilePath, []byte("0123456789abcdefghij"), 0644))
+	srcInfo, err := os.Stat(srcFilePath)
+	require.NoError(t, err)
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	targetFilePath := filepath.Join(targetRootPath, "large_file.bin")
+
+	// an interrupted run verified the first two chunks and left a torn third one,
+	// the verified prefix is marked so the test can tell it was not copied again
+	require.NoError(t, os.WriteFile(partialFilePath(targetFilePath), []byte("XXXXXXXXXXab"), 0644))
+	checkpoint := &chunkCheckpoint{
+		SourcePath:    srcFilePath,
+		SourceSize:    srcInfo.Size(),
+		SourceModTime: srcInfo.ModTime(),
+		ChunkSize:     5,
+		Chunks: []verifiedChunk{
+			{Offset: 0, Length: 5},
+			{Offset: 5, Length: 5},
+		},
+	}
+	require.NoError(t, checkpoint.save(checkpointFilePath(targetFilePath)))
+	testTask := BackupFileRequest{
+		CreationRequestTime: time.Now(),
+		SourcePath:          srcFilePath,
+		TargetPath:          targetFilePath,
+		Options: CopyOptions{
+			ChunkThreshold: 16,
+			ChunkSize:      5,
+		},
+	}
+
+	// when
+	resp := testTask.Do()
+
+	// then
+	assert.True(t, resp.CompletionStatus, resp.ErrorMessage)
+	data, err := os.ReadFile(targetFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, "XXXXXXXXXXabcdefghij", string(data))
+	assert.NoFileExists(t, checkpointFilePath(targetFilePath))
+}
+
+func TestBackupFile_Do_ChunkedStaleCheckpoint(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	srcFilePath := filepath.Join(srcRootPath, "large_file.bin")
+	require.NoError(t, os.WriteFile(srcFilePath, []byte("0123456789abcdefghij"), 0644))
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	targetFilePath := filepath.Join(targetRootPath, "large_file.bin")
+
+	// an interrupted copy of an older version of the source, its verified prefix must not be reused
+	require.NoError(t, os.WriteFile(partialFilePath(targetFilePath), []byte("XXXXXXXXXXXXXXXXXXXXXXXXX"), 0644))
+	checkpoint := &chunkCheckpoint{
+		SourcePath:    srcFilePath,
+		SourceSize:    25,
+		SourceModTime: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		ChunkSize:     5,
+		Chunks:        []verifiedChunk{{Offset: 0, Length: 5}, {Offset: 5, Length: 5}},
+	}
+	require.NoError(t, checkpoint.save(checkpointFilePath(targetFilePath)))
+	testTask := BackupFileRequest{
+		CreationRequestTime: time.Now(),
+		SourcePath:          srcFilePath,
+		TargetPath:          targetFilePath,
+		Options: CopyOptions{
+			ChunkThreshold: 16,
+			ChunkSize:      5,
+		},
+	}
+
+	// when
+	resp := testTask.Do()
+
+	// then
+	assert.True(t, resp.CompletionStatus, resp.ErrorMessage)
+	assert.EqualValues(t, 20, resp.BytesCopied)
+	data, err := os.ReadFile(targetFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdefghij", string(data))
+	assert.NoFileExists(t, partialFilePath(targetFilePath))
+	assert.NoFileExists(t, checkpointFilePath(targetFilePath))
+}
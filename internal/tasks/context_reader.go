@@ -0,0 +1,27 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// contextReader stops a copy between two reads once its context is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func newContextReader(ctx context.Context, reader io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return reader
+	}
+	return &contextReader{ctx: ctx, reader: reader}
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, fmt.Errorf("copy stopped: %w", err)
+	}
+	return c.reader.Read(p)
+}
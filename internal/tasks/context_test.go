@@ -0,0 +1,88 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFile_DoContext_Cancelled(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	srcFilePath := filepath.Join(srcRootPath, "test_file.txt")
+	require.NoError(t, os.WriteFile(srcFilePath, []byte("new content\n"), 0644))
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	targetFilePath := filepath.Join(targetRootPath, "test_file.txt")
+	testTask := BackupFileRequest{
+		CreationRequestTime: time.Now(),
+		SourcePath:          srcFilePath,
+		TargetPath:          targetFilePath,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	resp := testTask.DoContext(ctx)
+
+	// then
+	assert.False(t, resp.CompletionStatus)
+	assert.True(t, errors.Is(resp.Err, context.Canceled))
+	entries, err := os.ReadDir(targetRootPath)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSourceLister_DoContext_Cancelled(t *testing.T) {
+	// given
+	srcRootDir, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcRootDir, "one"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "one", "file.txt"), []byte("data"), 0644))
+	dirsWriter := new(strings.Builder)
+	filesWriter := new(strings.Builder)
+	lister, err := NewSourceLister(&NewSrcListerInput{
+		SrcRootDir:   srcRootDir,
+		DirsWriter:   dirsWriter,
+		FilesWriter:  filesWriter,
+		ErrorsWriter: new(strings.Builder),
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	err = lister.DoContext(ctx)
+
+	// then
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Empty(t, filesWriter.String())
+}
+
+func TestBackupDirSkeleton_DoContext_Cancelled(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcRootPath, "one"), 0755))
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	testTask := NewBackupDirSkeleton(strings.NewReader(filepath.Join(srcRootPath, "one")+"\n"), srcRootPath, targetRootPath, "block", false, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	_, errs := testTask.DoContext(ctx)
+
+	// then
+	require.NotEmpty(t, errs)
+	assert.True(t, errors.Is(errs[len(errs)-1], context.Canceled))
+	assert.NoDirExists(t, filepath.Join(targetRootPath, "one"))
+}
@@ -1,7 +1,8 @@
 package tasks
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,19 +11,26 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/AppleGamer22/recursive-backup/internal/listfile"
 	"github.com/AppleGamer22/recursive-backup/internal/rberrors"
 )
 
 type BackupDirSkeleton interface {
 	Do() (io.Reader, []error)
+	DoContext(ctx context.Context) (io.Reader, []error)
 }
 
-func NewBackupDirSkeleton(srcDirReader io.Reader, srcRootPath string, targetRootPath string, validationMode string) BackupDirSkeleton {
+// NewBackupDirSkeleton reads a dirs list with one path per line, or one NUL terminated path per record when nullDelimited,
+// and returns the created dirs in the same form. Unless the symlinks policy is SymlinksFollow, a listed dir that is a symlink
+// is validated as missing.
+func NewBackupDirSkeleton(srcDirReader io.Reader, srcRootPath string, targetRootPath string, validationMode string, nullDelimited bool, symlinks string) BackupDirSkeleton {
 	return &backupDirSkeleton{
 		SrcRootPath:          srcRootPath,
 		SrcDirectoriesReader: srcDirReader,
 		ValidationMode:       validationMode,
 		TargetRootPath:       targetRootPath,
+		NullDelimited:        nullDelimited,
+		Symlinks:             symlinks,
 	}
 }
 
@@ -31,9 +39,16 @@ type backupDirSkeleton struct {
 	SrcDirectoriesReader io.Reader
 	ValidationMode       string
 	TargetRootPath       string
+	NullDelimited        bool
+	Symlinks             string
 }
 
 func (b *backupDirSkeleton) Do() (io.Reader, []error) {
+	return b.DoContext(context.Background())
+}
+
+// DoContext stops creating directories once ctx is done, adding a wrapped ctx.Err() to the returned errors
+func (b *backupDirSkeleton) DoContext(ctx context.Context) (io.Reader, []error) {
 	var errs []error
 	dirs, err := b.extractLongPaths()
 	if err != nil && b.ValidationMode == "block" {
@@ -41,8 +56,13 @@ func (b *backupDirSkeleton) Do() (io.Reader, []error) {
 		return nil, errs
 	}
 
+	delimiter := b.delimiter()
 	builder := strings.Builder{}
 	for _, srcDirPath := range dirs {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			errs = append(errs, fmt.Errorf("directory skeleton stopped: %w", ctxErr))
+			break
+		}
 		trimmedSrcDirPath := strings.TrimPrefix(srcDirPath, b.SrcRootPath)
 		expression := fmt.Sprintf("\\%c{2,}", filepath.Separator)
 		exp := regexp.MustCompile(expression)
@@ -53,18 +73,25 @@ func (b *backupDirSkeleton) Do() (io.Reader, []error) {
 		if err != nil {
 			errs = append(errs, err)
 		} else {
-			builder.WriteString(fmt.Sprintf("%s\n", targetDirPath))
+			builder.WriteString(targetDirPath + delimiter)
 		}
 	}
 
-	paths := strings.Split(builder.String(), "\n")
+	paths := strings.Split(builder.String(), delimiter)
 	sort.Strings(paths)
-	out := strings.Join(paths, "\n")
-	out = strings.TrimPrefix(out, "\n")
+	out := strings.Join(paths, delimiter)
+	out = strings.TrimPrefix(out, delimiter)
 
 	return strings.NewReader(out), errs
 }
 
+func (b *backupDirSkeleton) delimiter() string {
+	if b.NullDelimited {
+		return "\x00"
+	}
+	return "\n"
+}
+
 func (b *backupDirSkeleton) extractLongPaths() (shortList []string, err error) {
 	dirs, err := b.getSortedSrcDirPaths()
 	if err != nil {
@@ -80,9 +107,13 @@ func (b *backupDirSkeleton) extractLongPaths() (shortList []string, err error) {
 		}
 	}
 
+	stat := os.Lstat
+	if b.Symlinks == SymlinksFollow {
+		stat = os.Stat
+	}
 	var missed []string
 	for _, dirPath := range dirs {
-		fileInfo, err := os.Stat(dirPath)
+		fileInfo, err := stat(dirPath)
 		if err != nil || !fileInfo.IsDir() {
 			switch b.ValidationMode {
 			case "report":
@@ -101,14 +132,24 @@ func (b *backupDirSkeleton) extractLongPaths() (shortList []string, err error) {
 func (b *backupDirSkeleton) getSortedSrcDirPaths() ([]string, error) {
 	var dirs []string
 
-	scan := bufio.NewScanner(b.SrcDirectoriesReader)
-	for scan.Scan() {
-		text := scan.Text()
-		dirs = append(dirs, text)
+	format := listfile.FormatPlain
+	if b.NullDelimited {
+		format = listfile.FormatNull
 	}
-	if err := scan.Err(); err != nil {
+	reader, err := listfile.NewReaderFormat(b.SrcDirectoriesReader, format)
+	if err != nil {
 		return nil, err
 	}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, record.Path)
+	}
 
 	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
 
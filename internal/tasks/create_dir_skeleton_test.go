@@ -2,8 +2,10 @@ package tasks
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -76,3 +78,29 @@ func TestBackupDirSkeleton_Do_success(t *testing.T) {
 
 	assert.Len(t, errs, 0)
 }
+
+func TestBackupDirSkeleton_Do_null_delimited(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file names cannot hold line breaks on windows")
+	}
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcRootPath, "one\ntwo"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcRootPath, "three"), 0755))
+	paths := fmt.Sprintf("%s\x00%s\x00%s\x00", srcRootPath, filepath.Join(srcRootPath, "one\ntwo"), filepath.Join(srcRootPath, "three"))
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	testTask := NewBackupDirSkeleton(strings.NewReader(paths), srcRootPath, targetRootPath, "block", true, "")
+
+	// when
+	reader, errs := testTask.Do()
+
+	// then
+	assert.Len(t, errs, 0)
+	assert.DirExists(t, filepath.Join(targetRootPath, "one\ntwo"))
+	assert.DirExists(t, filepath.Join(targetRootPath, "three"))
+	out, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s\x00%s", filepath.Join(targetRootPath, "one\ntwo"), filepath.Join(targetRootPath, "three")), string(out))
+}
@@ -0,0 +1,146 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ActionHardLink is the action of a response whose file was linked to the target of an earlier copy of the same inode
+const ActionHardLink = "hardlink"
+
+// NotPreservedHardLink is listed as not preserved by a file that was copied since it could not be linked on the target
+const NotPreservedHardLink = "hardlink"
+
+// HardLinks pairs the sources of a run that share an inode with the target of their first copy, so the other sources
+// are recreated as hard links to it. It is shared by all copy workers of a run and only knows the copies of that run.
+type HardLinks struct {
+	mu     sync.Mutex
+	groups map[fileKey]*hardLinkGroup
+}
+
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLinkGroup is closed once the first copy of an inode is done, target is set if it succeeded
+type hardLinkGroup struct {
+	done   chan struct{}
+	target string
+}
+
+func NewHardLinks() *HardLinks {
+	return &HardLinks{groups: make(map[fileKey]*hardLinkGroup)}
+}
+
+// claim returns the group of key, and whether the caller created it and must copy the file and complete the group
+func (h *HardLinks) claim(key fileKey) (*hardLinkGroup, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if group, ok := h.groups[key]; ok {
+		return group, false
+	}
+	group := &hardLinkGroup{done: make(chan struct{})}
+	h.groups[key] = group
+	return group, true
+}
+
+// complete publishes the target of the first copy. A failed copy drops the group, so the next source of the inode is copied.
+func (h *HardLinks) complete(key fileKey, group *hardLinkGroup, target string, err error) {
+	h.mu.Lock()
+	if err == nil {
+		group.target = target
+	} else {
+		delete(h.groups, key)
+	}
+	h.mu.Unlock()
+	close(group.done)
+}
+
+// doHardLink copies the first source of an inode with several links and links the other ones to its target.
+// It returns false for a source with a single link, which is copied as usual.
+func (b *BackupFileRequest) doHardLink(ctx context.Context) (BackupFileResponse, bool) {
+	info, err := os.Stat(b.SourcePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return BackupFileResponse{}, false
+	}
+	dev, ino, nlink, ok := fileIdentity(info)
+	if !ok || nlink < 2 {
+		return BackupFileResponse{}, false
+	}
+	key := fileKey{dev: dev, ino: ino}
+	for {
+		group, first := b.Options.HardLinks.claim(key)
+		if first {
+			response := b.doCopy(ctx)
+			b.Options.HardLinks.complete(key, group, b.TargetPath, response.Err)
+			return response, true
+		}
+		select {
+		case <-group.done:
+		case <-ctx.Done():
+			return b.Interrupt(ctx.Err()), true
+		}
+		if len(group.target) == 0 {
+			// the first copy failed, try to be the first one
+			continue
+		}
+		return b.linkTo(ctx, group.target), true
+	}
+}
+
+// linkTo links the target to the target of the first copy of the same inode, falling back to a copy
+// when the link cannot be created, e.g. when the two targets are on different filesystems
+func (b *BackupFileRequest) linkTo(ctx context.Context, firstTarget string) BackupFileResponse {
+	fmt.Printf(">>[w%d][b%d][f%d]>> ln %s -> %s\n", b.WorkerID, b.BatchID, b.FileID, firstTarget, b.TargetPath)
+	err := linkFile(firstTarget, b.TargetPath)
+	if err != nil {
+		fmt.Printf("<<[w%d][b%d][f%d][false]<< ln %s -> %s, copying instead: %v\n", b.WorkerID,
+			b.BatchID, b.FileID, firstTarget, b.TargetPath, err)
+		response := b.doCopy(ctx)
+		response.NotPreserved = append(response.NotPreserved, NotPreservedHardLink)
+		return response
+	}
+	fmt.Printf("<<[w%d][b%d][f%d][true]<< ln %s -> %s\n", b.WorkerID, b.BatchID, b.FileID, firstTarget, b.TargetPath)
+	return BackupFileResponse{
+		WorkerID:            b.WorkerID,
+		BatchID:             b.BatchID,
+		FileID:              b.FileID,
+		CreationRequestTime: b.CreationRequestTime,
+		CompletionTime:      time.Now(),
+		SourcePath:          b.SourcePath,
+		TargetPath:          b.TargetPath,
+		Action:              ActionHardLink,
+		CompletionStatus:    true,
+		ErrorMessage:        "success",
+	}
+}
+
+// linkFile creates a hard link to existing beside dst and renames it into place, so dst is replaced atomically.
+// A dst that already is a link to existing is kept, since renaming a link over itself leaves the temp link behind.
+func linkFile(existing, dst string) error {
+	if dstInfo, err := os.Stat(dst); err == nil {
+		if existingInfo, err := os.Stat(existing); err == nil && os.SameFile(dstInfo, existingInfo) {
+			return nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tempPath, err := createTempLink(dst, func(name string) error {
+		return os.Link(existing, name)
+	})
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tempPath, dst); err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+	syncDir(filepath.Dir(dst))
+	return nil
+}
@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFileRequest_Do_HardLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("link counts are not reported on windows")
+	}
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	names := []string{"first.txt", "second.txt", "third.txt"}
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootPath, names[0]), []byte("data"), 0644))
+	for _, name := range names[1:] {
+		require.NoError(t, os.Link(filepath.Join(srcRootPath, names[0]), filepath.Join(srcRootPath, name)))
+	}
+	options := CopyOptions{HardLinks: NewHardLinks()}
+	responses := make([]BackupFileResponse, len(names))
+
+	// when
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			request := BackupFileRequest{
+				SourcePath: filepath.Join(srcRootPath, name),
+				TargetPath: filepath.Join(targetRootPath, name),
+				Options:    options,
+			}
+			responses[i] = request.Do()
+		}(i, name)
+	}
+	wg.Wait()
+
+	// then
+	actions := map[string]int{}
+	for _, response := range responses {
+		assert.True(t, response.CompletionStatus, response.ErrorMessage)
+		actions[response.Action]++
+	}
+	assert.Equal(t, map[string]int{ActionCopy: 1, ActionHardLink: 2}, actions)
+	firstInfo, err := os.Stat(filepath.Join(targetRootPath, names[0]))
+	require.NoError(t, err)
+	for _, name := range names[1:] {
+		info, err := os.Stat(filepath.Join(targetRootPath, name))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(firstInfo, info), name)
+	}
+}
+
+func TestBackupFileRequest_Do_HardLinksDisabled(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("link counts are not reported on windows")
+	}
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootPath, "first.txt"), []byte("data"), 0644))
+	require.NoError(t, os.Link(filepath.Join(srcRootPath, "first.txt"), filepath.Join(srcRootPath, "second.txt")))
+
+	// when
+	for _, name := range []string{"first.txt", "second.txt"} {
+		request := BackupFileRequest{SourcePath: filepath.Join(srcRootPath, name), TargetPath: filepath.Join(targetRootPath, name)}
+		response := request.Do()
+		require.True(t, response.CompletionStatus, response.ErrorMessage)
+		assert.Equal(t, ActionCopy, response.Action)
+	}
+
+	// then
+	firstInfo, err := os.Stat(filepath.Join(targetRootPath, "first.txt"))
+	require.NoError(t, err)
+	secondInfo, err := os.Stat(filepath.Join(targetRootPath, "second.txt"))
+	require.NoError(t, err)
+	assert.False(t, os.SameFile(firstInfo, secondInfo))
+}
+
+func TestBackupFileRequest_linkTo_FallsBackToCopy(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootPath, "file.txt"), []byte("data"), 0644))
+	request := BackupFileRequest{SourcePath: filepath.Join(srcRootPath, "file.txt"), TargetPath: filepath.Join(targetRootPath, "file.txt")}
+
+	// when
+	response := request.linkTo(context.Background(), filepath.Join(targetRootPath, "missing.txt"))
+
+	// then
+	assert.True(t, response.CompletionStatus, response.ErrorMessage)
+	assert.Equal(t, ActionCopy, response.Action)
+	assert.Contains(t, response.NotPreserved, NotPreservedHardLink)
+	data, err := os.ReadFile(filepath.Join(targetRootPath, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
@@ -0,0 +1,83 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ActionLinkDest is the action of a response whose file was linked to its unchanged copy in a previous backup
+const ActionLinkDest = "link-dest"
+
+// LinkDest links the targets of unchanged sources to their copy in a previous backup of the same source,
+// so a new backup only takes the space of the changed files
+type LinkDest struct {
+	// Dir is the target root dir of the previous backup
+	Dir string
+	// TargetRootDir is the target root dir of the run, the path of a target below it is the path of its copy below Dir
+	TargetRootDir string
+	// Compare is the skip unchanged mode comparing a source with its copy in Dir, empty means SkipUnchangedSizeMTime
+	Compare string
+}
+
+// previousPath returns the copy of target in Dir, or false for a target outside of TargetRootDir
+func (l *LinkDest) previousPath(target string) (string, bool) {
+	relPath, err := filepath.Rel(l.TargetRootDir, target)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(l.Dir, relPath), true
+}
+
+// doLinkDest links the target to the copy of the source in the previous backup when the source did not change since.
+// It returns false when the file has to be copied: when there is no such copy, it differs in content or mode,
+// or the link cannot be created, e.g. when the copy reached the link limit of its filesystem.
+func (b *BackupFileRequest) doLinkDest(ctx context.Context) (BackupFileResponse, bool) {
+	linkDest := b.Options.LinkDest
+	previous, ok := linkDest.previousPath(b.TargetPath)
+	if !ok {
+		return BackupFileResponse{}, false
+	}
+	sourceInfo, err := os.Stat(b.SourcePath)
+	if err != nil || !sourceInfo.Mode().IsRegular() {
+		return BackupFileResponse{}, false
+	}
+	// the link shares the metadata of the previous copy
+	if previousInfo, err := os.Stat(previous); err != nil || previousInfo.Mode() != sourceInfo.Mode() {
+		return BackupFileResponse{}, false
+	}
+	mode := linkDest.Compare
+	if len(mode) == 0 {
+		mode = SkipUnchangedSizeMTime
+	}
+	comparison, ok := compareUnchanged(ctx, mode, b.SourcePath, sourceInfo, previous, b.Options.ChecksumAlgorithm)
+	if !ok {
+		return BackupFileResponse{}, false
+	}
+	fmt.Printf(">>[w%d][b%d][f%d]>> ln %s -> %s\n", b.WorkerID, b.BatchID, b.FileID, previous, b.TargetPath)
+	if err = linkFile(previous, b.TargetPath); err != nil {
+		fmt.Printf("<<[w%d][b%d][f%d][false]<< ln %s -> %s, copying instead: %v\n", b.WorkerID,
+			b.BatchID, b.FileID, previous, b.TargetPath, err)
+		return BackupFileResponse{}, false
+	}
+	fmt.Printf("<<[w%d][b%d][f%d][true]<< ln %s -> %s\n", b.WorkerID, b.BatchID, b.FileID, previous, b.TargetPath)
+	return BackupFileResponse{
+		WorkerID:            b.WorkerID,
+		BatchID:             b.BatchID,
+		FileID:              b.FileID,
+		CreationRequestTime: b.CreationRequestTime,
+		CompletionTime:      time.Now(),
+		SourcePath:          b.SourcePath,
+		TargetPath:          b.TargetPath,
+		Action:              ActionLinkDest,
+		CompletionStatus:    true,
+		ChecksumAlgorithm:   comparison.algorithm,
+		SourceChecksum:      comparison.sourceChecksum,
+		TargetChecksum:      comparison.copyChecksum,
+		LogicalBytes:        sourceInfo.Size(),
+		ErrorMessage:        "success",
+	}, true
+}
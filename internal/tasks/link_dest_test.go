@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFileRequest_Do_LinkDest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file identities are not compared on windows")
+	}
+	modTime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		title           string
+		compare         string
+		previousContent string
+		previousModTime time.Time
+		previousMode    os.FileMode
+		missingPrevious bool
+		expectedLinked  bool
+	}{
+		{title: "size-mtime unchanged", previousContent: "data", previousModTime: modTime, previousMode: 0644, expectedLinked: true},
+		{title: "size-mtime newer source", previousContent: "data", previousModTime: modTime.Add(-time.Hour), previousMode: 0644},
+		{title: "size-mtime other size", previousContent: "more data", previousModTime: modTime, previousMode: 0644},
+		{title: "other mode", previousContent: "data", previousModTime: modTime, previousMode: 0600},
+		{title: "checksum unchanged", compare: SkipUnchangedChecksum, previousContent: "data", previousModTime: modTime.Add(-time.Hour), previousMode: 0644, expectedLinked: true},
+		{title: "checksum other contents", compare: SkipUnchangedChecksum, previousContent: "atad", previousModTime: modTime, previousMode: 0644},
+		{title: "no previous copy", missingPrevious: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			// given
+			srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+			require.NoError(t, err)
+			snapshotsPath, err := os.MkdirTemp("", "snapshots_*")
+			require.NoError(t, err)
+			previousRootPath := filepath.Join(snapshotsPath, "previous")
+			targetRootPath := filepath.Join(snapshotsPath, "current")
+			require.NoError(t, os.MkdirAll(filepath.Join(previousRootPath, "dir"), 0755))
+			require.NoError(t, os.MkdirAll(filepath.Join(targetRootPath, "dir"), 0755))
+			require.NoError(t, os.Mkdir(filepath.Join(srcRootPath, "dir"), 0755))
+			srcPath := filepath.Join(srcRootPath, "dir", "file.txt")
+			previousPath := filepath.Join(previousRootPath, "dir", "file.txt")
+			targetPath := filepath.Join(targetRootPath, "dir", "file.txt")
+			require.NoError(t, os.WriteFile(srcPath, []byte("data"), 0644))
+			require.NoError(t, os.Chmod(srcPath, 0644))
+			require.NoError(t, os.Chtimes(srcPath, modTime, modTime))
+			if !tc.missingPrevious {
+				require.NoError(t, os.WriteFile(previousPath, []byte(tc.previousContent), tc.previousMode))
+				require.NoError(t, os.Chmod(previousPath, tc.previousMode))
+				require.NoError(t, os.Chtimes(previousPath, tc.previousModTime, tc.previousModTime))
+			}
+			request := BackupFileRequest{SourcePath: srcPath, TargetPath: targetPath, Options: CopyOptions{
+				LinkDest: &LinkDest{Dir: previousRootPath, TargetRootDir: targetRootPath, Compare: tc.compare},
+			}}
+
+			// when
+			response := request.Do()
+
+			// then
+			assert.True(t, response.CompletionStatus, response.ErrorMessage)
+			targetInfo, err := os.Stat(targetPath)
+			require.NoError(t, err)
+			if tc.expectedLinked {
+				assert.Equal(t, ActionLinkDest, response.Action)
+				previousInfo, err := os.Stat(previousPath)
+				require.NoError(t, err)
+				assert.True(t, os.SameFile(previousInfo, targetInfo))
+				assert.Zero(t, response.BytesCopied)
+				return
+			}
+			assert.Equal(t, ActionCopy, response.Action)
+			data, err := os.ReadFile(targetPath)
+			require.NoError(t, err)
+			assert.Equal(t, "data", string(data))
+			if previousInfo, err := os.Stat(previousPath); err == nil {
+				assert.False(t, os.SameFile(previousInfo, targetInfo))
+			}
+		})
+	}
+}
+
+func TestLinkDest_PreviousPath(t *testing.T) {
+	linkDest := &LinkDest{Dir: filepath.Join("snapshots", "previous"), TargetRootDir: filepath.Join("snapshots", "current")}
+
+	actual, ok := linkDest.previousPath(filepath.Join("snapshots", "current", "dir", "file.txt"))
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join("snapshots", "previous", "dir", "file.txt"), actual)
+
+	_, ok = linkDest.previousPath(filepath.Join("snapshots", "other", "file.txt"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,94 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// ListCriteria selects the listed files by size and modification time and limits the depth of the walk.
+// Zero values disable a criterion. Size and time criteria apply to files, directories are always walked.
+type ListCriteria struct {
+	MinSize int64
+	// MaxSize is the largest listed file size, zero means no maximum
+	MaxSize   int64
+	NewerThan *time.Time
+	OlderThan *time.Time
+	// MaxDepth lists entries up to this many levels below the source root and does not walk deeper, zero means unlimited
+	MaxDepth int
+}
+
+func (c ListCriteria) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.MinSize, validation.Min(int64(0))),
+		validation.Field(&c.MaxSize, validation.Min(int64(0)), validation.By(func(interface{}) error {
+			if c.MaxSize > 0 && c.MaxSize < c.MinSize {
+				return errors.New("must not be lower than MinSize")
+			}
+			return nil
+		})),
+		validation.Field(&c.MaxDepth, validation.Min(0)),
+		validation.Field(&c.OlderThan, validation.By(func(interface{}) error {
+			if c.OlderThan != nil && c.NewerThan != nil && !c.OlderThan.After(*c.NewerThan) {
+				return errors.New("must be after NewerThan")
+			}
+			return nil
+		})),
+	)
+}
+
+func (c ListCriteria) IsZero() bool {
+	return c.MinSize == 0 && c.MaxSize == 0 && c.NewerThan == nil && c.OlderThan == nil && c.MaxDepth == 0
+}
+
+func (c ListCriteria) String() string {
+	var criteria []string
+	if c.MinSize > 0 {
+		criteria = append(criteria, fmt.Sprintf("min size %d bytes", c.MinSize))
+	}
+	if c.MaxSize > 0 {
+		criteria = append(criteria, fmt.Sprintf("max size %d bytes", c.MaxSize))
+	}
+	if c.NewerThan != nil {
+		criteria = append(criteria, fmt.Sprintf("newer than %s", c.NewerThan.Format(time.RFC3339)))
+	}
+	if c.OlderThan != nil {
+		criteria = append(criteria, fmt.Sprintf("older than %s", c.OlderThan.Format(time.RFC3339)))
+	}
+	if c.MaxDepth > 0 {
+		criteria = append(criteria, fmt.Sprintf("max depth %d", c.MaxDepth))
+	}
+	if len(criteria) == 0 {
+		return "none"
+	}
+	return strings.Join(criteria, ", ")
+}
+
+// depth returns the number of levels path is below root, the root itself is at depth zero
+func depth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// matchesFile reports whether a file's size and modification time meet the criteria
+func (c ListCriteria) matchesFile(info fs.FileInfo) bool {
+	switch {
+	case info.Size() < c.MinSize:
+		return false
+	case c.MaxSize > 0 && info.Size() > c.MaxSize:
+		return false
+	case c.NewerThan != nil && !info.ModTime().After(*c.NewerThan):
+		return false
+	case c.OlderThan != nil && !info.ModTime().Before(*c.OlderThan):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package tasks
+
+import (
+	"fmt"
+	"io/fs"
+	"runtime"
+)
+
+func mknod(path string, _ fs.FileInfo) error {
+	return fmt.Errorf("cannot recreate special file %s, not supported on %s", path, runtime.GOOS)
+}
+
+func deviceNumber(_ fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
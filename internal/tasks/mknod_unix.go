@@ -0,0 +1,41 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package tasks
+
+import (
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+// mknod creates a node at path of the same type, permissions and device number as the special file of info
+func mknod(path string, info fs.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("no device number for %s", info.Name())
+	}
+	mode := uint32(info.Mode().Perm())
+	switch {
+	case info.Mode()&fs.ModeNamedPipe != 0:
+		mode |= syscall.S_IFIFO
+	case info.Mode()&fs.ModeSocket != 0:
+		mode |= syscall.S_IFSOCK
+	case info.Mode()&fs.ModeCharDevice != 0:
+		mode |= syscall.S_IFCHR
+	case info.Mode()&fs.ModeDevice != 0:
+		mode |= syscall.S_IFBLK
+	default:
+		return fmt.Errorf("%s is not a special file", info.Name())
+	}
+	return syscall.Mknod(path, mode, int(st.Rdev))
+}
+
+// deviceNumber returns the device number of a device node
+func deviceNumber(info fs.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Rdev), true
+}
@@ -0,0 +1,86 @@
+package tasks
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+const (
+	PreserveMode       = "mode"
+	PreserveTimestamps = "timestamps"
+	PreserveOwnership  = "ownership"
+	PreserveAll        = "all"
+	PreserveNone       = "none"
+)
+
+// PreserveOptions selects which source metadata is applied to a copied file
+type PreserveOptions struct {
+	Mode       bool
+	Timestamps bool
+	Ownership  bool
+}
+
+// ParsePreserveOptions parses a comma separated list of mode, timestamps and ownership (or all/none)
+func ParsePreserveOptions(s string) (PreserveOptions, error) {
+	var out PreserveOptions
+	for _, item := range strings.Split(s, ",") {
+		switch strings.TrimSpace(item) {
+		case "", PreserveNone:
+		case PreserveMode:
+			out.Mode = true
+		case PreserveTimestamps:
+			out.Timestamps = true
+		case PreserveOwnership:
+			out.Ownership = true
+		case PreserveAll:
+			out = PreserveOptions{Mode: true, Timestamps: true, Ownership: true}
+		default:
+			return PreserveOptions{}, fmt.Errorf("unknown preserve attribute %q, expecting one of %s, %s, %s, %s or %s",
+				item, PreserveMode, PreserveTimestamps, PreserveOwnership, PreserveAll, PreserveNone)
+		}
+	}
+	return out, nil
+}
+
+func (p PreserveOptions) String() string {
+	var attrs []string
+	if p.Mode {
+		attrs = append(attrs, PreserveMode)
+	}
+	if p.Timestamps {
+		attrs = append(attrs, PreserveTimestamps)
+	}
+	if p.Ownership {
+		attrs = append(attrs, PreserveOwnership)
+	}
+	if len(attrs) == 0 {
+		return PreserveNone
+	}
+	return strings.Join(attrs, ",")
+}
+
+// preserveMetadata applies the selected attributes of srcInfo to path and returns the attributes that could not be applied.
+// Ownership is applied first since chown may clear the setuid and setgid bits.
+func preserveMetadata(path string, srcInfo fs.FileInfo, opts PreserveOptions) []string {
+	var notPreserved []string
+	if opts.Ownership {
+		uid, gid, ok := fileOwner(srcInfo)
+		if !ok || os.Geteuid() != 0 || os.Lchown(path, uid, gid) != nil {
+			notPreserved = append(notPreserved, PreserveOwnership)
+		}
+	}
+	if opts.Mode {
+		mode := srcInfo.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+		if err := os.Chmod(path, mode); err != nil {
+			notPreserved = append(notPreserved, PreserveMode)
+		}
+	}
+	if opts.Timestamps {
+		if err := os.Chtimes(path, accessTime(srcInfo), srcInfo.ModTime()); err != nil {
+			notPreserved = append(notPreserved, PreserveTimestamps)
+		}
+	}
+	return notPreserved
+}
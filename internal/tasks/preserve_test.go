@@ -0,0 +1,89 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePreserveOptions(t *testing.T) {
+	testCases := []struct {
+		title           string
+		input           string
+		expected        PreserveOptions
+		isErrorExpected bool
+	}{
+		{
+			title:    "empty=>nothing preserved",
+			input:    "",
+			expected: PreserveOptions{},
+		}, {
+			title:    "none=>nothing preserved",
+			input:    "none",
+			expected: PreserveOptions{},
+		}, {
+			title:    "mode and timestamps",
+			input:    "mode, timestamps",
+			expected: PreserveOptions{Mode: true, Timestamps: true},
+		}, {
+			title:    "all",
+			input:    "all",
+			expected: PreserveOptions{Mode: true, Timestamps: true, Ownership: true},
+		}, {
+			title:           "unknown attribute=>expected error",
+			input:           "mode,xattrs",
+			isErrorExpected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			actual, err := ParsePreserveOptions(tc.input)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestBackupFile_Do_PreserveMetadata(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	srcFilePath := filepath.Join(srcRootPath, "test_file.txt")
+	require.NoError(t, os.WriteFile(srcFilePath, []byte("testing123\n"), 0600))
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(srcFilePath, modTime, modTime))
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	targetFilePath := filepath.Join(targetRootPath, "test_file.txt")
+	testTask := BackupFileRequest{
+		CreationRequestTime: time.Now(),
+		SourcePath:          srcFilePath,
+		TargetPath:          targetFilePath,
+		Options: CopyOptions{
+			Preserve: PreserveOptions{Mode: true, Timestamps: true},
+		},
+	}
+
+	// when
+	resp := testTask.Do()
+
+	// then
+	assert.True(t, resp.CompletionStatus)
+	assert.Empty(t, resp.NotPreserved)
+	targetInfo, err := os.Stat(targetFilePath)
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(targetInfo.ModTime()))
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), targetInfo.Mode().Perm())
+	}
+}
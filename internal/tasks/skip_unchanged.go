@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const (
+	// SkipUnchangedNever copies every file, also when the target already has the same contents
+	SkipUnchangedNever = "never"
+	// SkipUnchangedSizeMTime skips a file whose target has the same size and modification time, to the second.
+	// It needs targets copied with preserved timestamps.
+	SkipUnchangedSizeMTime = "size-mtime"
+	// SkipUnchangedChecksum skips a file whose target has the same size and checksum
+	SkipUnchangedChecksum = "checksum"
+)
+
+// skipChecksumAlgorithm compares a source and its target when no checksum algorithm is selected for verifying copies
+const skipChecksumAlgorithm = ChecksumXXHash
+
+// ValidateSkipUnchanged validates a skip unchanged mode, empty means SkipUnchangedNever
+func ValidateSkipUnchanged(mode string) error {
+	switch mode {
+	case "", SkipUnchangedNever, SkipUnchangedSizeMTime, SkipUnchangedChecksum:
+		return nil
+	default:
+		return fmt.Errorf("unknown skip unchanged mode %q, expecting %s, %s or %s", mode, SkipUnchangedSizeMTime, SkipUnchangedChecksum, SkipUnchangedNever)
+	}
+}
+
+// doSkipUnchanged compares the source with an existing target by the skip unchanged mode, and answers an unchanged one
+// as skipped. It returns false when the file has to be copied, including when the comparison fails.
+func (b *BackupFileRequest) doSkipUnchanged(ctx context.Context) (BackupFileResponse, bool) {
+	mode := b.Options.SkipUnchanged
+	if mode != SkipUnchangedSizeMTime && mode != SkipUnchangedChecksum {
+		return BackupFileResponse{}, false
+	}
+	sourceInfo, err := os.Stat(b.SourcePath)
+	if err != nil || !sourceInfo.Mode().IsRegular() {
+		return BackupFileResponse{}, false
+	}
+	comparison, ok := compareUnchanged(ctx, mode, b.SourcePath, sourceInfo, b.TargetPath, b.Options.ChecksumAlgorithm)
+	if !ok {
+		return BackupFileResponse{}, false
+	}
+	response := BackupFileResponse{
+		WorkerID:            b.WorkerID,
+		BatchID:             b.BatchID,
+		FileID:              b.FileID,
+		CreationRequestTime: b.CreationRequestTime,
+		CompletionTime:      time.Now(),
+		SourcePath:          b.SourcePath,
+		TargetPath:          b.TargetPath,
+		Action:              ActionCopy,
+		CompletionStatus:    true,
+		Skipped:             true,
+		ChecksumAlgorithm:   comparison.algorithm,
+		SourceChecksum:      comparison.sourceChecksum,
+		TargetChecksum:      comparison.copyChecksum,
+		LogicalBytes:        sourceInfo.Size(),
+		ErrorMessage:        fmt.Sprintf("unchanged (%s)", mode),
+	}
+	fmt.Printf("<<[w%d][b%d][f%d][skipped]<< cp %s -> %s unchanged\n", b.WorkerID, b.BatchID, b.FileID, b.SourcePath, b.TargetPath)
+	return response, true
+}
+
+// unchangedComparison holds the checksums computed by a SkipUnchangedChecksum comparison
+type unchangedComparison struct {
+	algorithm      string
+	sourceChecksum string
+	copyChecksum   string
+}
+
+// compareUnchanged compares a regular source with an existing copy of it by the skip unchanged mode.
+// The checksum mode uses checksumAlgorithm, or skipChecksumAlgorithm when it is not enabled.
+// It returns false when the copy differs, including when the comparison fails.
+func compareUnchanged(ctx context.Context, mode, sourcePath string, sourceInfo fs.FileInfo, copyPath, checksumAlgorithm string) (unchangedComparison, bool) {
+	var comparison unchangedComparison
+	copyInfo, err := os.Stat(copyPath)
+	if err != nil || !copyInfo.Mode().IsRegular() || copyInfo.Size() != sourceInfo.Size() {
+		return comparison, false
+	}
+	switch mode {
+	case SkipUnchangedSizeMTime:
+		return comparison, sourceInfo.ModTime().Truncate(time.Second).Equal(copyInfo.ModTime().Truncate(time.Second))
+	case SkipUnchangedChecksum:
+		if ctx.Err() != nil {
+			return comparison, false
+		}
+		algorithm := checksumAlgorithm
+		if !isChecksumEnabled(algorithm) {
+			algorithm = skipChecksumAlgorithm
+		}
+		if comparison.sourceChecksum, err = fileChecksum(sourcePath, algorithm); err != nil {
+			return comparison, false
+		}
+		if comparison.copyChecksum, err = fileChecksum(copyPath, algorithm); err != nil {
+			return comparison, false
+		}
+		if comparison.sourceChecksum != comparison.copyChecksum {
+			return comparison, false
+		}
+		comparison.algorithm = algorithm
+		return comparison, true
+	default:
+		return comparison, false
+	}
+}
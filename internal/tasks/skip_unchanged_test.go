@@ -0,0 +1,68 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFileRequest_Do_SkipUnchanged(t *testing.T) {
+	modTime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		title           string
+		mode            string
+		targetContent   string
+		targetModTime   time.Time
+		expectedSkipped bool
+	}{
+		{title: "size-mtime unchanged", mode: SkipUnchangedSizeMTime, targetContent: "data", targetModTime: modTime, expectedSkipped: true},
+		{title: "size-mtime same size but other contents", mode: SkipUnchangedSizeMTime, targetContent: "atad", targetModTime: modTime, expectedSkipped: true},
+		{title: "size-mtime newer source", mode: SkipUnchangedSizeMTime, targetContent: "data", targetModTime: modTime.Add(-time.Hour)},
+		{title: "size-mtime other size", mode: SkipUnchangedSizeMTime, targetContent: "more data", targetModTime: modTime},
+		{title: "checksum unchanged", mode: SkipUnchangedChecksum, targetContent: "data", targetModTime: modTime.Add(-time.Hour), expectedSkipped: true},
+		{title: "checksum other contents", mode: SkipUnchangedChecksum, targetContent: "atad", targetModTime: modTime},
+		{title: "never", mode: SkipUnchangedNever, targetContent: "data", targetModTime: modTime},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			// given
+			srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+			require.NoError(t, err)
+			targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+			require.NoError(t, err)
+			srcPath := filepath.Join(srcRootPath, "file.txt")
+			targetPath := filepath.Join(targetRootPath, "file.txt")
+			require.NoError(t, os.WriteFile(srcPath, []byte("data"), 0644))
+			require.NoError(t, os.Chtimes(srcPath, modTime, modTime))
+			require.NoError(t, os.WriteFile(targetPath, []byte(tc.targetContent), 0644))
+			require.NoError(t, os.Chtimes(targetPath, tc.targetModTime, tc.targetModTime))
+			request := BackupFileRequest{SourcePath: srcPath, TargetPath: targetPath, Options: CopyOptions{SkipUnchanged: tc.mode}}
+
+			// when
+			response := request.Do()
+
+			// then
+			assert.True(t, response.CompletionStatus, response.ErrorMessage)
+			assert.Equal(t, tc.expectedSkipped, response.Skipped)
+			data, err := os.ReadFile(targetPath)
+			require.NoError(t, err)
+			if tc.expectedSkipped {
+				assert.Equal(t, tc.targetContent, string(data))
+				assert.Zero(t, response.BytesCopied)
+				return
+			}
+			assert.Equal(t, "data", string(data))
+		})
+	}
+}
+
+func TestValidateSkipUnchanged(t *testing.T) {
+	for _, mode := range []string{"", SkipUnchangedNever, SkipUnchangedSizeMTime, SkipUnchangedChecksum} {
+		assert.NoError(t, ValidateSkipUnchanged(mode), mode)
+	}
+	assert.Error(t, ValidateSkipUnchanged("mtime"))
+}
@@ -2,19 +2,29 @@ package tasks
 
 import (
 	"bufio"
+	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/AppleGamer22/recursive-backup/internal/filter"
+	"github.com/AppleGamer22/recursive-backup/internal/listfile"
+	"github.com/AppleGamer22/recursive-backup/internal/manifest"
 	val "github.com/AppleGamer22/recursive-backup/internal/validationhelpers"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
 type SourceListerAPI interface {
 	Do() error
+	DoContext(ctx context.Context) error
 }
 
 type sourceLister struct {
@@ -23,6 +33,86 @@ type sourceLister struct {
 	DirsWriter    *bufio.Writer
 	FilesWriter   *bufio.Writer
 	ErrorsWriter  *bufio.Writer
+	hardLinks     *csv.Writer
+	special       *csv.Writer
+	manifest      *manifest.Writer
+	changes       *csv.Writer
+	Baseline      *manifest.Manifest
+	Filter        *filter.Filter
+	ListCriteria
+	Workers   int
+	Sorted    bool
+	Symlinks  string
+	Special   SpecialFilePolicy
+	filesList *listfile.Writer
+	dirsList  *listfile.Writer
+	// mu guards the writers, the counters and the sorted records, entries are visited concurrently with several Workers
+	mu             sync.Mutex
+	excluded       uint
+	prunedDirs     uint
+	unmatched      uint
+	linkedFiles    uint
+	skippedSpecial uint
+	// seen holds the manifest paths of the listed entries, the baseline paths missing from it were deleted
+	seen           map[string]bool
+	changeCounts   map[string]uint
+	sortedDirs     []listfile.Record
+	sortedFiles    []listfile.Record
+	sortedErrors   []string
+	sortedLinks    []hardLinkRow
+	sortedSpecial  []specialRow
+	sortedManifest []manifest.Entry
+	sortedChanges  []changeRow
+}
+
+// hardLinkRow is a row of the hard links list, a listed file sharing its inode with other paths
+type hardLinkRow struct {
+	dev   uint64
+	ino   uint64
+	links uint64
+	path  string
+}
+
+// hardLinksHeader is the header of the CSV hard links list
+var hardLinksHeader = []string{"device", "inode", "links", "path"}
+
+func (r hardLinkRow) fields() []string {
+	return []string{
+		strconv.FormatUint(r.dev, 10),
+		strconv.FormatUint(r.ino, 10),
+		strconv.FormatUint(r.links, 10),
+		r.path,
+	}
+}
+
+// specialRow is a row of the special files list, a FIFO, socket or device node that is reported or recreated
+type specialRow struct {
+	kind   string
+	policy string
+	mode   fs.FileMode
+	device string
+	path   string
+}
+
+// specialHeader is the header of the CSV special files list
+var specialHeader = []string{"type", "policy", "mode", "device", "path"}
+
+func (r specialRow) fields() []string {
+	return []string{r.kind, r.policy, r.mode.String(), r.device, r.path}
+}
+
+// changeRow is a row of the changes list, an entry added, modified or deleted since the baseline manifest
+type changeRow struct {
+	change string
+	kind   string
+	path   string
+}
+
+// changesHeader is the header of the CSV changes list
+var changesHeader = []string{"change", "type", "path"}
+
+func (r changeRow) fields() []string {
+	return []string{r.change, r.kind, r.path}
 }
 
 type NewSrcListerInput struct {
@@ -31,6 +121,37 @@ type NewSrcListerInput struct {
 	DirsWriter    io.Writer
 	FilesWriter   io.Writer
 	ErrorsWriter  io.Writer
+	// HardLinksWriter receives the device, inode, link count and path of the listed files with several hard links as CSV.
+	// Nil does not list them.
+	HardLinksWriter io.Writer
+	// SpecialWriter receives the type, policy, mode, device number and path of the FIFOs, sockets and device nodes that
+	// are reported or recreated as CSV. Nil does not list them.
+	SpecialWriter io.Writer
+	// Filter excludes entries from the lists, excluded directories are not walked. Nil lists everything.
+	Filter *filter.Filter
+	ListCriteria
+	// ListFormat is the listfile format of the files list, empty means plain
+	ListFormat string
+	// NullDelimited terminates the paths of the dirs list and of a plain files list with NUL instead of a line break
+	NullDelimited bool
+	// Workers is the number of directories read concurrently, zero or one walks the tree sequentially in lexical order
+	Workers int
+	// Sorted holds the entries found by several Workers in memory and writes them in the order of a sequential walk
+	Sorted bool
+	// Symlinks is the symlink policy, SymlinksCopyLink lists symlinks as files and SymlinksFollow lists what they point to.
+	// Empty means SymlinksSkip.
+	Symlinks string
+	// Special is the policy of each special file type, SpecialRecreate also lists them as files
+	Special SpecialFilePolicy
+	// ManifestWriter receives the manifest of every listed dir and file, also of those matching the ReferenceTime or
+	// the Baseline. Nil does not write it.
+	ManifestWriter io.Writer
+	// Baseline is the manifest of a previous backup. Only the entries added or modified since then are listed,
+	// instead of those modified after the ReferenceTime.
+	Baseline *manifest.Manifest
+	// ChangesWriter receives the change, type and path of the entries added, modified or deleted since the Baseline as CSV.
+	// Nil does not list them.
+	ChangesWriter io.Writer
 }
 
 func (i *NewSrcListerInput) Validate() error {
@@ -39,6 +160,21 @@ func (i *NewSrcListerInput) Validate() error {
 		validation.Field(&i.DirsWriter, validation.Required, validation.NotNil),
 		validation.Field(&i.FilesWriter, validation.Required, validation.NotNil),
 		validation.Field(&i.ErrorsWriter, validation.Required, validation.NotNil),
+		validation.Field(&i.ListCriteria),
+		validation.Field(&i.Workers, validation.Min(0)),
+		validation.Field(&i.Baseline, validation.When(i.ReferenceTime != nil, validation.Nil.Error("cannot be used with a reference time"))),
+		validation.Field(&i.Symlinks, validation.By(func(interface{}) error {
+			return ValidateSymlinks(i.Symlinks)
+		})),
+		validation.Field(&i.ListFormat, validation.By(func(interface{}) error {
+			if len(i.ListFormat) == 0 {
+				return nil
+			}
+			if i.NullDelimited && i.ListFormat != listfile.FormatPlain && i.ListFormat != listfile.FormatNull {
+				return errors.New("must be plain when the lists are NUL delimited")
+			}
+			return listfile.ValidateFormat(i.ListFormat)
+		})),
 	)
 }
 
@@ -53,45 +189,323 @@ func NewSourceLister(input *NewSrcListerInput) (SourceListerAPI, error) {
 		FilesWriter:   bufio.NewWriter(input.FilesWriter),
 		ErrorsWriter:  bufio.NewWriter(input.ErrorsWriter),
 		ReferenceTime: input.ReferenceTime,
+		Filter:        input.Filter,
+		ListCriteria:  input.ListCriteria,
+		Workers:       input.Workers,
+		Sorted:        input.Sorted,
+		Symlinks:      input.Symlinks,
+		Special:       input.Special,
+		Baseline:      input.Baseline,
+	}
+	format := input.ListFormat
+	if len(format) == 0 {
+		format = listfile.FormatPlain
+	}
+	dirsFormat := listfile.FormatPlain
+	if input.NullDelimited {
+		format = listfile.FormatNull
+		dirsFormat = listfile.FormatNull
+	}
+	var err error
+	if srcLister.filesList, err = listfile.NewWriter(srcLister.FilesWriter, format); err != nil {
+		return nil, err
+	}
+	if srcLister.dirsList, err = listfile.NewWriter(srcLister.DirsWriter, dirsFormat); err != nil {
+		return nil, err
+	}
+	if input.HardLinksWriter != nil {
+		srcLister.hardLinks = csv.NewWriter(input.HardLinksWriter)
+		if err = srcLister.hardLinks.Write(hardLinksHeader); err != nil {
+			return nil, err
+		}
+	}
+	if input.SpecialWriter != nil {
+		srcLister.special = csv.NewWriter(input.SpecialWriter)
+		if err = srcLister.special.Write(specialHeader); err != nil {
+			return nil, err
+		}
+	}
+	if input.ManifestWriter != nil {
+		if srcLister.manifest, err = manifest.NewWriter(input.ManifestWriter); err != nil {
+			return nil, err
+		}
+	}
+	if input.Baseline != nil {
+		srcLister.seen = make(map[string]bool)
+		srcLister.changeCounts = make(map[string]uint)
+		if input.ChangesWriter != nil {
+			srcLister.changes = csv.NewWriter(input.ChangesWriter)
+			if err = srcLister.changes.Write(changesHeader); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return srcLister, nil
 }
 
 func (s *sourceLister) Do() error {
+	return s.DoContext(context.Background())
+}
+
+// DoContext stops walking once ctx is done and returns a wrapped ctx.Err(), the entries listed so far are flushed
+func (s *sourceLister) DoContext(ctx context.Context) error {
+	walkFunc := s.walkDirFunc
 	if s.ReferenceTime != nil {
-		if err := filepath.WalkDir(s.SrcRootDir, s.walkDirFuncWithReferenceTime); err != nil {
-			return err
-		}
-	} else {
-		if err := filepath.WalkDir(s.SrcRootDir, s.walkDirFunc); err != nil {
-			return err
+		walkFunc = s.walkDirFuncWithReferenceTime
+	}
+	visit := func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("listing %s stopped: %w", s.SrcRootDir, ctxErr)
 		}
+		return s.visit(path, d, err, walkFunc)
+	}
+	err := walkDir(s.SrcRootDir, walkOptions{Workers: s.Workers, FollowSymlinks: s.Symlinks == SymlinksFollow}, visit)
+	if s.Baseline != nil && err == nil {
+		s.writeDeleted()
+	}
+	if s.Sorted {
+		s.writeSorted()
+	}
+	if s.unmatched > 0 {
+		msg := fmt.Sprintf("criteria-summary: skipped %d files not matching the list criteria (%s)\n", s.unmatched, s.ListCriteria)
+		fmt.Print(msg)
+		_, _ = s.ErrorsWriter.WriteString(msg)
+	}
+	if s.linkedFiles > 0 {
+		msg := fmt.Sprintf("hardlink-summary: %d listed files have more than one hard link\n", s.linkedFiles)
+		fmt.Print(msg)
+		_, _ = s.ErrorsWriter.WriteString(msg)
+	}
+	if s.skippedSpecial > 0 {
+		msg := fmt.Sprintf("special-summary: skipped %d special files (%s)\n", s.skippedSpecial, s.Special)
+		fmt.Print(msg)
+		_, _ = s.ErrorsWriter.WriteString(msg)
+	}
+	if s.Baseline != nil {
+		msg := fmt.Sprintf("manifest-summary: %d added, %d modified, %d deleted and %d unchanged entries since the baseline manifest of %d entries\n",
+			s.changeCounts[manifest.Added], s.changeCounts[manifest.Modified], s.changeCounts[manifest.Deleted], s.changeCounts[manifest.Unchanged], s.Baseline.Len())
+		fmt.Print(msg)
+		_, _ = s.ErrorsWriter.WriteString(msg)
+	}
+	if s.excluded > 0 {
+		msg := fmt.Sprintf("filter-summary: excluded %d entries, %d of them directories that were not walked\n", s.excluded, s.prunedDirs)
+		fmt.Print(msg)
+		_, _ = s.ErrorsWriter.WriteString(msg)
 	}
 	_ = s.DirsWriter.Flush()
+	_ = s.filesList.Flush()
 	_ = s.FilesWriter.Flush()
 	_ = s.ErrorsWriter.Flush()
+	if s.hardLinks != nil {
+		s.hardLinks.Flush()
+	}
+	if s.special != nil {
+		s.special.Flush()
+	}
+	if s.manifest != nil {
+		_ = s.manifest.Flush()
+	}
+	if s.changes != nil {
+		s.changes.Flush()
+	}
 
+	return err
+}
+
+// visit applies the line break check, the filter and the list criteria to an entry before handing it to walkFunc
+func (s *sourceLister) visit(path string, d fs.DirEntry, err error, walkFunc fs.WalkDirFunc) error {
+	if err == nil && s.hasLineBreak(path, d) {
+		msg := fmt.Sprintf("%q, path contains a line break, list with -0/--null to back it up\n", path)
+		fmt.Print(msg)
+		s.writeError(msg)
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	}
+	if err == nil && s.Filter != nil {
+		if skip, skipErr := s.applyFilter(path, d); skip {
+			return skipErr
+		}
+	}
+	if err == nil && !d.IsDir() && s.isUnmatchedFile(d) {
+		s.mu.Lock()
+		s.unmatched++
+		s.mu.Unlock()
+		return nil
+	}
+	if err == nil && s.recordManifest(path, d) == manifest.Unchanged {
+		return s.skipBelowMaxDepth(path, d)
+	}
+	if walkErr := walkFunc(path, d, err); walkErr != nil {
+		return walkErr
+	}
+	return s.skipBelowMaxDepth(path, d)
+}
+
+// skipBelowMaxDepth returns fs.SkipDir for a directory at the MaxDepth
+func (s *sourceLister) skipBelowMaxDepth(path string, d fs.DirEntry) error {
+	if d != nil && d.IsDir() && s.MaxDepth > 0 && depth(s.SrcRootDir, path) >= s.MaxDepth {
+		return fs.SkipDir
+	}
 	return nil
 }
 
+// recordManifest writes the manifest row of an entry that may be listed and returns how it changed since the Baseline.
+// Without a Baseline every entry is manifest.Added, so the walk funcs list it as usual.
+// The files whose size matches the baseline are compared by their content when the baseline holds their checksum,
+// so a file restored with a new mtime is not copied again.
+func (s *sourceLister) recordManifest(path string, d fs.DirEntry) string {
+	if s.manifest == nil && s.Baseline == nil {
+		return manifest.Added
+	}
+	info, err := d.Info()
+	if err != nil || path == s.SrcRootDir || !s.isManifested(info) {
+		return manifest.Added
+	}
+	relPath, err := filepath.Rel(s.SrcRootDir, path)
+	if err != nil {
+		return manifest.Added
+	}
+	_, ino, _, _ := fileIdentity(info)
+	entry := manifest.Entry{Path: relPath, Mode: info.Mode(), ModTime: info.ModTime(), Inode: ino}
+	if !info.IsDir() {
+		entry.Size = info.Size()
+	}
+	change := manifest.Added
+	if s.Baseline != nil {
+		change = s.Baseline.Compare(entry)
+		if previous, ok := s.Baseline.Get(relPath); ok && len(previous.Checksum) > 0 {
+			if change == manifest.Modified && previous.Size == entry.Size && info.Mode().IsRegular() {
+				if checksum, err := fileChecksum(path, previous.ChecksumAlgorithm); err == nil && checksum == previous.Checksum {
+					change = manifest.Unchanged
+				}
+			}
+			if change == manifest.Unchanged {
+				entry.ChecksumAlgorithm, entry.Checksum = previous.ChecksumAlgorithm, previous.Checksum
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.manifest != nil {
+		if s.Sorted {
+			s.sortedManifest = append(s.sortedManifest, entry)
+		} else {
+			_ = s.manifest.Write(entry)
+		}
+	}
+	if s.Baseline != nil {
+		s.seen[relPath] = true
+		s.changeCounts[change]++
+		if change != manifest.Unchanged {
+			s.writeChange(changeRow{change: change, kind: entryKind(info.Mode()), path: path})
+		}
+	}
+	return change
+}
+
+// isManifested reports whether an entry is listed in the dirs or files list when it changes
+func (s *sourceLister) isManifested(info fs.FileInfo) bool {
+	mode := info.Mode()
+	switch {
+	case mode.IsDir(), mode.IsRegular():
+		return true
+	case mode&fs.ModeSymlink != 0:
+		return s.Symlinks == SymlinksCopyLink
+	case isSpecial(mode):
+		_, policy := s.Special.For(mode)
+		return policy == SpecialRecreate
+	default:
+		return false
+	}
+}
+
+// writeChange lists an entry added, modified or deleted since the Baseline, the caller holds mu
+func (s *sourceLister) writeChange(row changeRow) {
+	if s.changes == nil {
+		return
+	}
+	if s.Sorted {
+		s.sortedChanges = append(s.sortedChanges, row)
+		return
+	}
+	_ = s.changes.Write(row.fields())
+}
+
+// writeDeleted lists the Baseline entries that were not listed, they were deleted or are excluded now
+func (s *sourceLister) writeDeleted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.Baseline.Entries() {
+		if s.seen[entry.Path] {
+			continue
+		}
+		s.changeCounts[manifest.Deleted]++
+		s.writeChange(changeRow{change: manifest.Deleted, kind: entryKind(entry.Mode), path: filepath.Join(s.SrcRootDir, entry.Path)})
+	}
+}
+
+func entryKind(mode fs.FileMode) string {
+	if mode.IsDir() {
+		return "dir"
+	}
+	return "file"
+}
+
+// applyFilter reports whether the entry is excluded, returning fs.SkipDir for an excluded directory.
+// The ignore file of a directory that is walked is loaded before its entries are visited.
+func (s *sourceLister) applyFilter(path string, d fs.DirEntry) (bool, error) {
+	if s.Filter.Excluded(path, d.IsDir()) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.excluded++
+		if d.IsDir() {
+			s.prunedDirs++
+			return true, fs.SkipDir
+		}
+		return true, nil
+	}
+	if d.IsDir() {
+		if err := s.Filter.LoadDir(path); err != nil {
+			s.writeError(fmt.Sprintf("%s, %v\n", path, err))
+		}
+	}
+	return false, nil
+}
+
+// isUnmatchedFile reports whether d is a regular file outside of the size and time criteria
+func (s *sourceLister) isUnmatchedFile(d fs.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return !s.ListCriteria.matchesFile(info)
+}
+
 func (s *sourceLister) walkDirFunc(path string, d fs.DirEntry, err error) error {
 	switch {
 	case err != nil:
-		_, _ = s.ErrorsWriter.WriteString(fmt.Sprintf("%s, %v\n", path, err))
+		s.writeError(fmt.Sprintf("%s, %v\n", path, err))
 		// if d.IsDir() {
 		// 	return fs.SkipDir
 		// }
 	case d.IsDir():
-		_, _ = s.DirsWriter.WriteString(fmt.Sprintf("%s\n", path))
+		s.writeDir(path)
 	case dirEntryError(d) != nil:
-		_, _ = s.ErrorsWriter.WriteString(fmt.Sprintf("%s, %v\n", path, dirEntryError(d)))
+		s.writeError(fmt.Sprintf("%s, %v\n", path, dirEntryError(d)))
 		return fs.SkipDir
 	case isRegular(d):
-		_, _ = s.FilesWriter.WriteString(fmt.Sprintf("%s\n", path))
+		s.writeFile(path, d)
+	case isSymlink(d):
+		s.writeSymlink(path, d)
+	case isSpecial(d.Type()):
+		s.writeSpecial(path, d)
 	default:
 		msg := "unexpected_element"
-		_, _ = s.ErrorsWriter.WriteString(fmt.Sprintf("path: %s, type: %v error_msg: %s\n", path, d.Type(), msg))
+		s.writeError(fmt.Sprintf("path: %s, type: %v error_msg: %s\n", path, d.Type(), msg))
 	}
 	return nil
 }
@@ -102,24 +516,192 @@ func (s *sourceLister) walkDirFuncWithReferenceTime(path string, d fs.DirEntry,
 	}
 	switch {
 	case err != nil:
-		_, _ = s.ErrorsWriter.WriteString(fmt.Sprintf("%s, %v\n", path, err))
+		s.writeError(fmt.Sprintf("%s, %v\n", path, err))
 		// if d.IsDir() {
 		// 	return fs.SkipDir
 		// }
 	case d.IsDir() && isAfterReferenceTime(d, *s.ReferenceTime):
-		_, _ = s.DirsWriter.WriteString(fmt.Sprintf("%s\n", path))
+		s.writeDir(path)
 	case dirEntryError(d) != nil:
-		_, _ = s.ErrorsWriter.WriteString(fmt.Sprintf("%s, %v\n", path, dirEntryError(d)))
+		s.writeError(fmt.Sprintf("%s, %v\n", path, dirEntryError(d)))
 		return fs.SkipDir
 	case isRegular(d) && isAfterReferenceTime(d, *s.ReferenceTime):
-		_, _ = s.FilesWriter.WriteString(fmt.Sprintf("%s\n", path))
+		s.writeFile(path, d)
+	case isSymlink(d):
+		if isAfterReferenceTime(d, *s.ReferenceTime) {
+			s.writeSymlink(path, d)
+		}
+	case isSpecial(d.Type()):
+		if isAfterReferenceTime(d, *s.ReferenceTime) {
+			s.writeSpecial(path, d)
+		}
 	default:
 		msg := "unexpected_element"
-		_, _ = s.ErrorsWriter.WriteString(fmt.Sprintf("path: %s, type: %v error_msg: %s\n", path, d.Type(), msg))
+		s.writeError(fmt.Sprintf("path: %s, type: %v error_msg: %s\n", path, d.Type(), msg))
 	}
 	return nil
 }
 
+// hasLineBreak reports whether path would be split in two by a line delimited list.
+// A directory is always listed in the dirs list, a file only in a plain files list.
+func (s *sourceLister) hasLineBreak(path string, d fs.DirEntry) bool {
+	if !strings.ContainsAny(path, "\n\r") {
+		return false
+	}
+	if d.IsDir() {
+		return s.dirsList.Format() == listfile.FormatPlain
+	}
+	return s.filesList.Format() == listfile.FormatPlain
+}
+
+func (s *sourceLister) writeFile(path string, d fs.DirEntry) {
+	fileInfo, _ := d.Info()
+	dev, ino, nlink, _ := fileIdentity(fileInfo)
+	linked := nlink > 1 && fileInfo.Mode().IsRegular()
+	record := listfile.Record{
+		Path:    path,
+		Size:    fileInfo.Size(),
+		ModTime: fileInfo.ModTime(),
+		Mode:    fileInfo.Mode(),
+		Inode:   ino,
+		Links:   nlink,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if linked {
+		s.linkedFiles++
+		s.writeHardLink(hardLinkRow{dev: dev, ino: ino, links: nlink, path: path})
+	}
+	if s.Sorted {
+		s.sortedFiles = append(s.sortedFiles, record)
+		return
+	}
+	_ = s.filesList.Write(record)
+}
+
+// writeHardLink lists a file with several hard links, the caller holds mu
+func (s *sourceLister) writeHardLink(row hardLinkRow) {
+	if s.hardLinks == nil {
+		return
+	}
+	if s.Sorted {
+		s.sortedLinks = append(s.sortedLinks, row)
+		return
+	}
+	_ = s.hardLinks.Write(row.fields())
+}
+
+// writeSymlink lists a symlink as a file with the copy-link policy and quietly notes it in the errors list with the skip policy.
+// Followed symlinks never get here, the walk hands over what they point to or the error of a broken link.
+func (s *sourceLister) writeSymlink(path string, d fs.DirEntry) {
+	if s.Symlinks == SymlinksCopyLink {
+		s.writeFile(path, d)
+		return
+	}
+	s.writeError(fmt.Sprintf("path: %s, type: %v error_msg: skipped_symlink\n", path, d.Type()))
+}
+
+// writeSpecial lists a FIFO, socket or device node in the special files list, and as a file when it is recreated.
+// Skipped ones are only counted.
+func (s *sourceLister) writeSpecial(path string, d fs.DirEntry) {
+	info, _ := d.Info()
+	kind, policy := s.Special.For(info.Mode())
+	if policy == SpecialSkip {
+		s.mu.Lock()
+		s.skippedSpecial++
+		s.mu.Unlock()
+		return
+	}
+	row := specialRow{kind: kind, policy: policy, mode: info.Mode(), path: path}
+	if rdev, ok := deviceNumber(info); ok && kind == SpecialDevice {
+		row.device = strconv.FormatUint(rdev, 10)
+	}
+	s.mu.Lock()
+	if s.special != nil {
+		if s.Sorted {
+			s.sortedSpecial = append(s.sortedSpecial, row)
+		} else {
+			_ = s.special.Write(row.fields())
+		}
+	}
+	s.mu.Unlock()
+	if policy == SpecialRecreate {
+		s.writeFile(path, d)
+	}
+}
+
+func (s *sourceLister) writeDir(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Sorted {
+		s.sortedDirs = append(s.sortedDirs, listfile.Record{Path: path})
+		return
+	}
+	_ = s.dirsList.Write(listfile.Record{Path: path})
+}
+
+func (s *sourceLister) writeError(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Sorted {
+		s.sortedErrors = append(s.sortedErrors, msg)
+		return
+	}
+	_, _ = s.ErrorsWriter.WriteString(msg)
+}
+
+// writeSorted writes the entries held by a sorted walk in the order filepath.WalkDir visits them
+func (s *sourceLister) writeSorted() {
+	sortRecords := func(records []listfile.Record) {
+		sort.Slice(records, func(i, j int) bool {
+			return comparePaths(records[i].Path, records[j].Path) < 0
+		})
+	}
+	sortRecords(s.sortedDirs)
+	sortRecords(s.sortedFiles)
+	sort.Strings(s.sortedErrors)
+	for _, record := range s.sortedDirs {
+		_ = s.dirsList.Write(record)
+	}
+	for _, record := range s.sortedFiles {
+		_ = s.filesList.Write(record)
+	}
+	for _, msg := range s.sortedErrors {
+		_, _ = s.ErrorsWriter.WriteString(msg)
+	}
+	sort.Slice(s.sortedLinks, func(i, j int) bool {
+		return comparePaths(s.sortedLinks[i].path, s.sortedLinks[j].path) < 0
+	})
+	for _, row := range s.sortedLinks {
+		_ = s.hardLinks.Write(row.fields())
+	}
+	sort.Slice(s.sortedSpecial, func(i, j int) bool {
+		return comparePaths(s.sortedSpecial[i].path, s.sortedSpecial[j].path) < 0
+	})
+	for _, row := range s.sortedSpecial {
+		_ = s.special.Write(row.fields())
+	}
+	sort.Slice(s.sortedManifest, func(i, j int) bool {
+		return comparePaths(s.sortedManifest[i].Path, s.sortedManifest[j].Path) < 0
+	})
+	for _, entry := range s.sortedManifest {
+		_ = s.manifest.Write(entry)
+	}
+	// deleted rows follow the listed ones, like in a sequential walk
+	sort.SliceStable(s.sortedChanges, func(i, j int) bool {
+		iDeleted, jDeleted := s.sortedChanges[i].change == manifest.Deleted, s.sortedChanges[j].change == manifest.Deleted
+		if iDeleted != jDeleted {
+			return jDeleted
+		}
+		return comparePaths(s.sortedChanges[i].path, s.sortedChanges[j].path) < 0
+	})
+	for _, row := range s.sortedChanges {
+		_ = s.changes.Write(row.fields())
+	}
+	s.sortedDirs, s.sortedFiles, s.sortedErrors, s.sortedLinks, s.sortedSpecial = nil, nil, nil, nil, nil
+	s.sortedManifest, s.sortedChanges = nil, nil
+}
+
 func isRegular(d fs.DirEntry) bool {
 	fileInfo, _ := d.Info()
 	return fileInfo.Mode().IsRegular()
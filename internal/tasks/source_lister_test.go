@@ -1,6 +1,7 @@
 package tasks
 
 import (
+	"encoding/csv"
 	"fmt"
 	"io"
 	"math/rand"
@@ -10,7 +11,10 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/AppleGamer22/recursive-backup/internal/filter"
+	"github.com/AppleGamer22/recursive-backup/internal/manifest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -234,7 +238,7 @@ func getExpectedErrorLogs(srcRootDir string, errorPathsSlice []string) []string
 	for _, p := range errorPathsSlice {
 		if len(p) > 0 {
 			path := filepath.Join(srcRootDir, p)
-			line := fmt.Sprintf("path: %s, type: L--------- error_msg: unexpected_element", path)
+			line := fmt.Sprintf("path: %s, type: L--------- error_msg: skipped_symlink", path)
 			out = append(out, line)
 		}
 	}
@@ -290,3 +294,420 @@ func setupSymlink(t *testing.T, testPath, symSource string, symLinks []string) {
 		}
 	}
 }
+
+func TestListSources_Filter(t *testing.T) {
+	// given
+	srcRootDir, err := os.MkdirTemp("", "filterListSrcDir_*")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcRootDir, "web", "node_modules", "pkg"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcRootDir, ".git"), 0755))
+	for _, name := range []string{"main.go", "scratch.tmp", filepath.Join("web", "index.js"), filepath.Join("web", "node_modules", "pkg", "lib.js"), filepath.Join(".git", "HEAD")} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, name), []byte("data"), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "web", filter.DefaultIgnoreFileName), []byte("node_modules/\n"), 0644))
+	sourceFilter, err := filter.New(srcRootDir, filter.Options{
+		Excludes:       []string{".git/", "*.tmp"},
+		IgnoreFileName: filter.DefaultIgnoreFileName,
+	})
+	require.NoError(t, err)
+	dirsWriter := new(strings.Builder)
+	filesWriter := new(strings.Builder)
+	errorsWriter := new(strings.Builder)
+	lister, err := NewSourceLister(&NewSrcListerInput{
+		SrcRootDir:   srcRootDir,
+		DirsWriter:   dirsWriter,
+		FilesWriter:  filesWriter,
+		ErrorsWriter: errorsWriter,
+		Filter:       sourceFilter,
+	})
+	require.NoError(t, err)
+
+	// when
+	err = lister.Do()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s\n%s\n", srcRootDir, filepath.Join(srcRootDir, "web")), dirsWriter.String())
+	assert.Equal(t, fmt.Sprintf("%s\n%s\n%s\n",
+		filepath.Join(srcRootDir, "main.go"),
+		filepath.Join(srcRootDir, "web", filter.DefaultIgnoreFileName),
+		filepath.Join(srcRootDir, "web", "index.js"),
+	), filesWriter.String())
+	assert.Equal(t, "filter-summary: excluded 3 entries, 2 of them directories that were not walked\n", errorsWriter.String())
+}
+
+func TestListSources_Criteria(t *testing.T) {
+	// given
+	srcRootDir, err := os.MkdirTemp("", "criteriaListSrcDir_*")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcRootDir, "one", "two"), 0755))
+	old := time.Now().Add(-48 * time.Hour)
+	files := map[string]int{
+		"small.txt":                          1,
+		"big.txt":                            100,
+		"old.txt":                            10,
+		filepath.Join("one", "nested.txt"):   10,
+		filepath.Join("one", "two", "deep"):  10,
+		filepath.Join("one", "too_big.bin"):  1000,
+		filepath.Join("one", "matching.bin"): 50,
+	}
+	for name, size := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, name), make([]byte, size), 0644))
+	}
+	require.NoError(t, os.Chtimes(filepath.Join(srcRootDir, "old.txt"), old, old))
+	newerThan := time.Now().Add(-24 * time.Hour)
+	dirsWriter := new(strings.Builder)
+	filesWriter := new(strings.Builder)
+	lister, err := NewSourceLister(&NewSrcListerInput{
+		SrcRootDir:   srcRootDir,
+		DirsWriter:   dirsWriter,
+		FilesWriter:  filesWriter,
+		ErrorsWriter: new(strings.Builder),
+		ListCriteria: ListCriteria{MinSize: 5, MaxSize: 100, NewerThan: &newerThan, MaxDepth: 2},
+	})
+	require.NoError(t, err)
+
+	// when
+	err = lister.Do()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s\n%s\n%s\n", srcRootDir, filepath.Join(srcRootDir, "one"), filepath.Join(srcRootDir, "one", "two")), dirsWriter.String())
+	assert.Equal(t, fmt.Sprintf("%s\n%s\n%s\n",
+		filepath.Join(srcRootDir, "big.txt"),
+		filepath.Join(srcRootDir, "one", "matching.bin"),
+		filepath.Join(srcRootDir, "one", "nested.txt"),
+	), filesWriter.String())
+}
+
+func TestListCriteria_Validate(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	assert.NoError(t, ListCriteria{}.Validate())
+	assert.NoError(t, ListCriteria{MinSize: 1, MaxSize: 2, NewerThan: &earlier, OlderThan: &now}.Validate())
+	assert.Error(t, ListCriteria{MinSize: 3, MaxSize: 2}.Validate())
+	assert.Error(t, ListCriteria{MaxDepth: -1}.Validate())
+	assert.Error(t, ListCriteria{NewerThan: &now, OlderThan: &earlier}.Validate())
+}
+
+func TestListSources_LineBreaks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file names cannot hold line breaks on windows")
+	}
+	testCases := []struct {
+		name          string
+		nullDelimited bool
+	}{
+		{name: "legacy lists report line breaks"},
+		{name: "NUL terminated lists keep line breaks", nullDelimited: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// given
+			srcRootDir, err := os.MkdirTemp("", "lineBreakListSrcDir_*")
+			require.NoError(t, err)
+			require.NoError(t, os.MkdirAll(filepath.Join(srcRootDir, "new\ndir"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "new\ndir", "a.txt"), []byte("data"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "line\nbreak.txt"), []byte("data"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "plain.txt"), []byte("data"), 0644))
+			dirsWriter := new(strings.Builder)
+			filesWriter := new(strings.Builder)
+			errorsWriter := new(strings.Builder)
+			lister, err := NewSourceLister(&NewSrcListerInput{
+				SrcRootDir:    srcRootDir,
+				DirsWriter:    dirsWriter,
+				FilesWriter:   filesWriter,
+				ErrorsWriter:  errorsWriter,
+				NullDelimited: tc.nullDelimited,
+			})
+			require.NoError(t, err)
+
+			// when
+			err = lister.Do()
+
+			// then
+			assert.NoError(t, err)
+			if tc.nullDelimited {
+				assert.Equal(t, fmt.Sprintf("%s\x00%s\x00", srcRootDir, filepath.Join(srcRootDir, "new\ndir")), dirsWriter.String())
+				assert.Equal(t, fmt.Sprintf("%s\x00%s\x00%s\x00",
+					filepath.Join(srcRootDir, "line\nbreak.txt"),
+					filepath.Join(srcRootDir, "new\ndir", "a.txt"),
+					filepath.Join(srcRootDir, "plain.txt"),
+				), filesWriter.String())
+				assert.Empty(t, errorsWriter.String())
+				return
+			}
+			assert.Equal(t, fmt.Sprintf("%s\n", srcRootDir), dirsWriter.String())
+			assert.Equal(t, fmt.Sprintf("%s\n", filepath.Join(srcRootDir, "plain.txt")), filesWriter.String())
+			assert.Contains(t, errorsWriter.String(), fmt.Sprintf("%q, path contains a line break", filepath.Join(srcRootDir, "line\nbreak.txt")))
+			assert.Contains(t, errorsWriter.String(), fmt.Sprintf("%q, path contains a line break", filepath.Join(srcRootDir, "new\ndir")))
+		})
+	}
+}
+
+func TestNewSourceLister_NullDelimitedRequiresPlainFormat(t *testing.T) {
+	_, err := NewSourceLister(&NewSrcListerInput{
+		SrcRootDir:    os.TempDir(),
+		DirsWriter:    new(strings.Builder),
+		FilesWriter:   new(strings.Builder),
+		ErrorsWriter:  new(strings.Builder),
+		ListFormat:    "csv",
+		NullDelimited: true,
+	})
+	assert.Error(t, err)
+}
+
+func TestListSources_ParallelWorkers(t *testing.T) {
+	// given
+	srcRootDir, err := os.MkdirTemp("", "parallelListSrcDir_*")
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 4; j++ {
+			dir := filepath.Join(srcRootDir, fmt.Sprintf("dir%d", i), fmt.Sprintf("sub%d", j))
+			require.NoError(t, os.MkdirAll(dir, 0755))
+			for k := 0; k < 3; k++ {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d.txt", k)), []byte("data"), 0644))
+			}
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, fmt.Sprintf("dir%d.txt", i)), []byte("data"), 0644))
+	}
+	list := func(workers int, sorted bool) (string, string) {
+		dirsWriter := new(strings.Builder)
+		filesWriter := new(strings.Builder)
+		lister, err := NewSourceLister(&NewSrcListerInput{
+			SrcRootDir:   srcRootDir,
+			DirsWriter:   dirsWriter,
+			FilesWriter:  filesWriter,
+			ErrorsWriter: new(strings.Builder),
+			Workers:      workers,
+			Sorted:       sorted,
+		})
+		require.NoError(t, err)
+		require.NoError(t, lister.Do())
+		return dirsWriter.String(), filesWriter.String()
+	}
+	sortedLines := func(s string) []string {
+		lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+		sort.Strings(lines)
+		return lines
+	}
+
+	// when
+	sequentialDirs, sequentialFiles := list(1, false)
+	parallelDirs, parallelFiles := list(8, false)
+	sortedDirs, sortedFiles := list(8, true)
+
+	// then
+	assert.Len(t, sortedLines(sequentialDirs), 26)
+	assert.Len(t, sortedLines(sequentialFiles), 65)
+	assert.Equal(t, sortedLines(sequentialDirs), sortedLines(parallelDirs))
+	assert.Equal(t, sortedLines(sequentialFiles), sortedLines(parallelFiles))
+	assert.Equal(t, sequentialDirs, sortedDirs)
+	assert.Equal(t, sequentialFiles, sortedFiles)
+}
+
+func TestListSources_Symlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires a privilege on windows")
+	}
+	// given
+	srcRootDir, err := os.MkdirTemp("", "symlinksListSrcDir_*")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcRootDir, "real"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "real", "file.txt"), []byte("data"), 0644))
+	require.NoError(t, os.Symlink("real", filepath.Join(srcRootDir, "linked_dir")))
+	require.NoError(t, os.Symlink("..", filepath.Join(srcRootDir, "real", "loop")))
+	testCases := []struct {
+		symlinks       string
+		workers        int
+		expectedDirs   []string
+		expectedFiles  []string
+		expectedErrors int
+	}{
+		{
+			symlinks:       SymlinksSkip,
+			expectedDirs:   []string{srcRootDir, filepath.Join(srcRootDir, "real")},
+			expectedFiles:  []string{filepath.Join(srcRootDir, "real", "file.txt")},
+			expectedErrors: 2,
+		},
+		{
+			symlinks:     SymlinksCopyLink,
+			expectedDirs: []string{srcRootDir, filepath.Join(srcRootDir, "real")},
+			expectedFiles: []string{
+				filepath.Join(srcRootDir, "linked_dir"),
+				filepath.Join(srcRootDir, "real", "file.txt"),
+				filepath.Join(srcRootDir, "real", "loop"),
+			},
+		},
+		{
+			symlinks:       SymlinksFollow,
+			expectedDirs:   []string{srcRootDir, filepath.Join(srcRootDir, "linked_dir"), filepath.Join(srcRootDir, "real")},
+			expectedFiles:  []string{filepath.Join(srcRootDir, "linked_dir", "file.txt"), filepath.Join(srcRootDir, "real", "file.txt")},
+			expectedErrors: 2,
+		},
+		{
+			symlinks:       SymlinksFollow,
+			workers:        4,
+			expectedDirs:   []string{srcRootDir, filepath.Join(srcRootDir, "linked_dir"), filepath.Join(srcRootDir, "real")},
+			expectedFiles:  []string{filepath.Join(srcRootDir, "linked_dir", "file.txt"), filepath.Join(srcRootDir, "real", "file.txt")},
+			expectedErrors: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s with %d workers", tc.symlinks, tc.workers), func(t *testing.T) {
+			dirsWriter := new(strings.Builder)
+			filesWriter := new(strings.Builder)
+			errorsWriter := new(strings.Builder)
+			lister, err := NewSourceLister(&NewSrcListerInput{
+				SrcRootDir:   srcRootDir,
+				DirsWriter:   dirsWriter,
+				FilesWriter:  filesWriter,
+				ErrorsWriter: errorsWriter,
+				Workers:      tc.workers,
+				Sorted:       true,
+				Symlinks:     tc.symlinks,
+			})
+			require.NoError(t, err)
+
+			// when
+			err = lister.Do()
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Join(tc.expectedDirs, "\n")+"\n", dirsWriter.String())
+			assert.Equal(t, strings.Join(tc.expectedFiles, "\n")+"\n", filesWriter.String())
+			assert.Equal(t, tc.expectedErrors, strings.Count(errorsWriter.String(), "\n"), errorsWriter.String())
+		})
+	}
+}
+
+func TestListSources_HardLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("link counts are not reported on windows")
+	}
+	// given
+	srcRootDir, err := os.MkdirTemp("", "hardLinksListSrcDir_*")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "a.txt"), []byte("data"), 0644))
+	require.NoError(t, os.Link(filepath.Join(srcRootDir, "a.txt"), filepath.Join(srcRootDir, "b.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "single.txt"), []byte("data"), 0644))
+	hardLinksWriter := new(strings.Builder)
+	errorsWriter := new(strings.Builder)
+	lister, err := NewSourceLister(&NewSrcListerInput{
+		SrcRootDir:      srcRootDir,
+		DirsWriter:      new(strings.Builder),
+		FilesWriter:     new(strings.Builder),
+		ErrorsWriter:    errorsWriter,
+		HardLinksWriter: hardLinksWriter,
+	})
+	require.NoError(t, err)
+
+	// when
+	err = lister.Do()
+
+	// then
+	assert.NoError(t, err)
+	records, err := csv.NewReader(strings.NewReader(hardLinksWriter.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, hardLinksHeader, records[0])
+	assert.Equal(t, filepath.Join(srcRootDir, "a.txt"), records[1][3])
+	assert.Equal(t, filepath.Join(srcRootDir, "b.txt"), records[2][3])
+	assert.Equal(t, records[1][:3], records[2][:3])
+	assert.Equal(t, "2", records[1][2])
+	assert.Contains(t, errorsWriter.String(), "hardlink-summary: 2 listed files")
+}
+
+func TestListSources_AgainstManifest(t *testing.T) {
+	// given
+	srcRootDir, err := os.MkdirTemp("", "manifestListSrcDir_*")
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(filepath.Join(srcRootDir, "dir"), 0755))
+	for _, name := range []string{"restored.txt", "touched.txt", "same.txt", "deleted.txt", filepath.Join("dir", "old.txt")} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, name), []byte("data"), 0644))
+	}
+	baselineWriter := new(strings.Builder)
+	lister, err := NewSourceLister(&NewSrcListerInput{
+		SrcRootDir:     srcRootDir,
+		DirsWriter:     new(strings.Builder),
+		FilesWriter:    new(strings.Builder),
+		ErrorsWriter:   new(strings.Builder),
+		ManifestWriter: baselineWriter,
+	})
+	require.NoError(t, err)
+	require.NoError(t, lister.Do())
+	baseline, err := manifest.Read(strings.NewReader(baselineWriter.String()))
+	require.NoError(t, err)
+	require.Equal(t, 6, baseline.Len())
+	touched, ok := baseline.Get("touched.txt")
+	require.True(t, ok)
+	touched.ChecksumAlgorithm = ChecksumXXHash
+	touched.Checksum, err = fileChecksum(filepath.Join(srcRootDir, "touched.txt"), ChecksumXXHash)
+	require.NoError(t, err)
+	baseline.Add(touched)
+
+	oldTime := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "restored.txt"), []byte("other"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(srcRootDir, "restored.txt"), oldTime, oldTime))
+	require.NoError(t, os.Chtimes(filepath.Join(srcRootDir, "touched.txt"), oldTime, oldTime))
+	require.NoError(t, os.Remove(filepath.Join(srcRootDir, "deleted.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "dir", "new.txt"), []byte("data"), 0644))
+	dirsWriter := new(strings.Builder)
+	filesWriter := new(strings.Builder)
+	errorsWriter := new(strings.Builder)
+	changesWriter := new(strings.Builder)
+	manifestWriter := new(strings.Builder)
+	lister, err = NewSourceLister(&NewSrcListerInput{
+		SrcRootDir:     srcRootDir,
+		DirsWriter:     dirsWriter,
+		FilesWriter:    filesWriter,
+		ErrorsWriter:   errorsWriter,
+		ManifestWriter: manifestWriter,
+		Baseline:       baseline,
+		ChangesWriter:  changesWriter,
+	})
+	require.NoError(t, err)
+
+	// when
+	err = lister.Do()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, srcRootDir+"\n", dirsWriter.String(), "a dir whose mtime changed with a new child is not listed")
+	assert.Equal(t, filepath.Join(srcRootDir, "dir", "new.txt")+"\n"+filepath.Join(srcRootDir, "restored.txt")+"\n", filesWriter.String())
+	changes, err := csv.NewReader(strings.NewReader(changesWriter.String())).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		changesHeader,
+		{manifest.Added, "file", filepath.Join(srcRootDir, "dir", "new.txt")},
+		{manifest.Modified, "file", filepath.Join(srcRootDir, "restored.txt")},
+		{manifest.Deleted, "file", filepath.Join(srcRootDir, "deleted.txt")},
+	}, changes)
+	assert.Contains(t, errorsWriter.String(), "manifest-summary: 1 added, 1 modified, 1 deleted and 4 unchanged entries")
+	current, err := manifest.Read(strings.NewReader(manifestWriter.String()))
+	require.NoError(t, err)
+	assert.Equal(t, 6, current.Len())
+	touched, ok = current.Get("touched.txt")
+	require.True(t, ok)
+	assert.True(t, touched.ModTime.Equal(oldTime))
+	assert.NotEmpty(t, touched.Checksum, "the checksum of an unchanged content is carried")
+}
+
+func TestNewSourceLister_BaselineWithReferenceTime(t *testing.T) {
+	// given
+	referenceTime := time.Now()
+	input := &NewSrcListerInput{
+		SrcRootDir:    os.TempDir(),
+		DirsWriter:    new(strings.Builder),
+		FilesWriter:   new(strings.Builder),
+		ErrorsWriter:  new(strings.Builder),
+		ReferenceTime: &referenceTime,
+		Baseline:      manifest.New(),
+	}
+
+	// when
+	_, err := NewSourceLister(input)
+
+	// then
+	assert.Error(t, err)
+}
@@ -0,0 +1,200 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+
+	"github.com/AppleGamer22/recursive-backup/internal/throttle"
+)
+
+// sparseBlockSize is the granularity of the zero runs that are left as holes on the target, the block size of most filesystems
+const sparseBlockSize = 4096
+
+// sparseHoleThreshold is the length from which a zero run in the data of a source is left as a hole with
+// CopyOptions.SparseZeroRuns, shorter runs are written with the data around them so dense files are not fragmented
+const sparseHoleThreshold = 64 * 1024
+
+// sparseWriteSize is the size of the writes sparseWriter merges the data of a source into
+const sparseWriteSize = 1 << 20
+
+var zeroBlock = make([]byte, 32*1024)
+
+// extent is a range of a file that holds data, the ranges between extents are holes
+type extent struct {
+	offset int64
+	length int64
+}
+
+// sparseExtents returns the data extents of length bytes at offset of source, and whether the range is copied sparsely:
+// with opts.Sparse when it has holes, or with opts.SparseZeroRuns as well. A range copied as is goes through a plain copy.
+func sparseExtents(source *os.File, offset, length int64, opts CopyOptions) ([]extent, bool, error) {
+	if !opts.Sparse {
+		return nil, false, nil
+	}
+	extents, err := dataExtents(source, offset, length)
+	if err != nil {
+		return nil, false, err
+	}
+	dense := len(extents) == 1 && extents[0] == extent{offset: offset, length: length}
+	return extents, opts.SparseZeroRuns || !dense, nil
+}
+
+// copySparseRange copies length bytes at offset of source to the same offset of target without writing the holes of the
+// source, given by extents, nor with opts.SparseZeroRuns the long zero runs of its data, so target gets holes where source has them.
+// Target is extended to offset+length. Holes are written to h as zeros, so h sees the whole range. It returns the bytes read.
+func copySparseRange(ctx context.Context, source, target *os.File, extents []extent, offset, length int64, opts CopyOptions, h io.Writer) (int64, error) {
+	writer := &sparseWriter{file: target, zeroRuns: opts.SparseZeroRuns}
+	var read int64
+	position := offset
+	for _, e := range extents {
+		if err := writeZeros(h, e.offset-position); err != nil {
+			return read, err
+		}
+		var reader io.Reader = throttle.NewReader(ctx, newContextReader(ctx, io.NewSectionReader(source, e.offset, e.length)), opts.Limiter)
+		if h != nil {
+			reader = io.TeeReader(reader, h)
+		}
+		writer.offset = e.offset
+		n, err := io.CopyN(writer, reader, e.length)
+		read += n
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			return read, err
+		}
+		position = e.offset + e.length
+	}
+	if err := writeZeros(h, offset+length-position); err != nil {
+		return read, err
+	}
+	return read, target.Truncate(offset + length)
+}
+
+// sparseWriter writes at offset of file, merging the data into writes of up to sparseWriteSize bytes.
+// With zeroRuns the runs of zero blocks of at least sparseHoleThreshold bytes are skipped, leaving holes.
+// Flush writes what is pending once all of a range is written.
+type sparseWriter struct {
+	file     *os.File
+	offset   int64
+	zeroRuns bool
+	// pending is the data not written yet, at pendingOffset
+	pending       []byte
+	pendingOffset int64
+	// zeros is the length of the zero run ending at offset, not written yet
+	zeros int64
+}
+
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		size := sparseBlockSize - int(w.offset%sparseBlockSize)
+		if size > len(p) {
+			size = len(p)
+		}
+		block := p[:size]
+		if w.zeroRuns && size == sparseBlockSize && bytes.Equal(block, zeroBlock[:size]) {
+			w.zeros += int64(size)
+		} else if err := w.writeData(block); err != nil {
+			return written, err
+		}
+		w.offset += int64(size)
+		written += size
+		p = p[size:]
+	}
+	return written, nil
+}
+
+// Flush writes the pending data and the zero run following it, unless that run is long enough to be left as a hole
+func (w *sparseWriter) Flush() error {
+	if w.zeros < sparseHoleThreshold {
+		w.addZeros()
+	}
+	w.zeros = 0
+	return w.writePending()
+}
+
+// writeData adds block at offset to the pending data, after the zero run preceding it or after a hole for a long one
+func (w *sparseWriter) writeData(block []byte) error {
+	if w.zeros >= sparseHoleThreshold {
+		if err := w.writePending(); err != nil {
+			return err
+		}
+		w.zeros = 0
+	}
+	w.addZeros()
+	if len(w.pending) == 0 {
+		w.pendingOffset = w.offset
+	}
+	w.pending = append(w.pending, block...)
+	if len(w.pending) >= sparseWriteSize {
+		return w.writePending()
+	}
+	return nil
+}
+
+// addZeros moves the zero run ending at offset to the pending data
+func (w *sparseWriter) addZeros() {
+	if w.zeros == 0 {
+		return
+	}
+	if len(w.pending) == 0 {
+		w.pendingOffset = w.offset - w.zeros
+	}
+	for w.zeros > 0 {
+		size := int64(len(zeroBlock))
+		if size > w.zeros {
+			size = w.zeros
+		}
+		w.pending = append(w.pending, zeroBlock[:size]...)
+		w.zeros -= size
+	}
+}
+
+func (w *sparseWriter) writePending() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	_, err := w.file.WriteAt(w.pending, w.pendingOffset)
+	w.pending = w.pending[:0]
+	return err
+}
+
+func writeZeros(w io.Writer, n int64) error {
+	if w == nil {
+		return nil
+	}
+	for n > 0 {
+		size := int64(len(zeroBlock))
+		if size > n {
+			size = n
+		}
+		if _, err := w.Write(zeroBlock[:size]); err != nil {
+			return err
+		}
+		n -= size
+	}
+	return nil
+}
+
+// physicalBytes returns the bytes of the file at path that hold data, size when its holes cannot be found
+func physicalBytes(path string, size int64) int64 {
+	file, err := os.Open(path)
+	if err != nil {
+		return size
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	extents, err := dataExtents(file, 0, size)
+	if err != nil {
+		return size
+	}
+	var physical int64
+	for _, e := range extents {
+		physical += e.length
+	}
+	return physical
+}
@@ -0,0 +1,159 @@
+package tasks
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFile_Do_Sparse(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	srcFilePath := filepath.Join(srcRootPath, "disk.img")
+	source, err := os.Create(srcFilePath)
+	require.NoError(t, err)
+	_, err = source.WriteAt([]byte("header"), 0)
+	require.NoError(t, err)
+	// a short zero run stays data, a long one is a hole on the target with SparseZeroRuns
+	_, err = source.WriteAt(make([]byte, 2*sparseBlockSize), 16*sparseBlockSize)
+	require.NoError(t, err)
+	_, err = source.WriteAt(make([]byte, 32*sparseBlockSize), 24*sparseBlockSize)
+	require.NoError(t, err)
+	_, err = source.WriteAt([]byte("middle"), 64*sparseBlockSize)
+	require.NoError(t, err)
+	require.NoError(t, source.Truncate(128*sparseBlockSize))
+	require.NoError(t, source.Close())
+	content, err := os.ReadFile(srcFilePath)
+	require.NoError(t, err)
+	sourcePhysical := physicalBytes(srcFilePath, int64(len(content)))
+	testCases := []struct {
+		title            string
+		opts             CopyOptions
+		expectedPhysical int64
+	}{
+		{title: "whole file", opts: CopyOptions{Sparse: true, ChecksumAlgorithm: ChecksumSHA256}, expectedPhysical: sourcePhysical},
+		{title: "chunked", opts: CopyOptions{Sparse: true, ChecksumAlgorithm: ChecksumSHA256, ChunkThreshold: 1, ChunkSize: 40 * sparseBlockSize},
+			expectedPhysical: sourcePhysical},
+		{title: "whole file zero runs", opts: CopyOptions{Sparse: true, SparseZeroRuns: true, ChecksumAlgorithm: ChecksumSHA256},
+			expectedPhysical: 4 * sparseBlockSize},
+		{title: "chunked zero runs", opts: CopyOptions{Sparse: true, SparseZeroRuns: true, ChecksumAlgorithm: ChecksumSHA256, ChunkThreshold: 1, ChunkSize: 40 * sparseBlockSize},
+			expectedPhysical: 4 * sparseBlockSize},
+		{title: "not sparse", opts: CopyOptions{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+			require.NoError(t, err)
+			targetFilePath := filepath.Join(targetRootPath, "disk.img")
+			request := BackupFileRequest{CreationRequestTime: time.Now(), SourcePath: srcFilePath, TargetPath: targetFilePath, Options: tc.opts}
+
+			// when
+			response := request.Do()
+
+			// then
+			require.True(t, response.CompletionStatus, response.ErrorMessage)
+			assert.Equal(t, response.SourceChecksum, response.TargetChecksum)
+			data, err := os.ReadFile(targetFilePath)
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(content, data))
+			assert.Equal(t, int64(len(content)), response.LogicalBytes)
+			if !tc.opts.Sparse {
+				assert.Equal(t, response.LogicalBytes, response.PhysicalBytes)
+				return
+			}
+			if runtime.GOOS == "linux" && sourcePhysical < int64(len(content)) {
+				assert.Equal(t, tc.expectedPhysical, response.PhysicalBytes)
+			}
+		})
+	}
+}
+
+func TestBackupFile_Do_SparseDenseSource(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	srcFilePath := filepath.Join(srcRootPath, "dense.bin")
+	content := append(append([]byte("head"), make([]byte, 32*sparseBlockSize)...), []byte("tail")...)
+	require.NoError(t, os.WriteFile(srcFilePath, content, 0644))
+	testCases := []struct {
+		title        string
+		opts         CopyOptions
+		expectedHole bool
+	}{
+		{title: "holes only", opts: CopyOptions{Sparse: true}},
+		{title: "zero runs", opts: CopyOptions{Sparse: true, SparseZeroRuns: true}, expectedHole: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+			require.NoError(t, err)
+			targetFilePath := filepath.Join(targetRootPath, "dense.bin")
+			request := BackupFileRequest{CreationRequestTime: time.Now(), SourcePath: srcFilePath, TargetPath: targetFilePath, Options: tc.opts}
+
+			// when
+			response := request.Do()
+
+			// then
+			require.True(t, response.CompletionStatus, response.ErrorMessage)
+			data, err := os.ReadFile(targetFilePath)
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(content, data))
+			if runtime.GOOS != "linux" {
+				return
+			}
+			if tc.expectedHole {
+				assert.Less(t, response.PhysicalBytes, response.LogicalBytes)
+			} else {
+				assert.Equal(t, response.LogicalBytes, response.PhysicalBytes)
+			}
+		})
+	}
+}
+
+func TestSparseWriter_Write(t *testing.T) {
+	testCases := []struct {
+		title    string
+		zeroRuns bool
+		zeros    int
+	}{
+		{title: "data", zeros: 3 * sparseBlockSize},
+		{title: "short zero run", zeroRuns: true, zeros: 3 * sparseBlockSize},
+		{title: "long zero run", zeroRuns: true, zeros: sparseHoleThreshold + 3*sparseBlockSize},
+		{title: "data beyond the write size", zeros: sparseWriteSize + sparseBlockSize},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			// given
+			targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+			require.NoError(t, err)
+			file, err := os.Create(filepath.Join(targetRootPath, "file.bin"))
+			require.NoError(t, err)
+			defer func() {
+				_ = file.Close()
+			}()
+			content := append(append([]byte("head"), make([]byte, tc.zeros)...), []byte("tail")...)
+			writer := &sparseWriter{file: file, zeroRuns: tc.zeroRuns}
+
+			// when
+			n, err := writer.Write(content[:len(content)/2])
+			require.NoError(t, err)
+			m, err := writer.Write(content[len(content)/2:])
+			require.NoError(t, err)
+			require.NoError(t, writer.Flush())
+
+			// then
+			assert.Equal(t, len(content), n+m)
+			assert.Equal(t, int64(len(content)), writer.offset)
+			data, err := os.ReadFile(file.Name())
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(content, data))
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package tasks
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lseek whence values, missing from the syscall package
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// dataExtents returns the ranges of file holding data between offset and offset+length with SEEK_DATA and SEEK_HOLE.
+// A filesystem without them reports the whole range as data.
+func dataExtents(file *os.File, offset, length int64) ([]extent, error) {
+	end := offset + length
+	var extents []extent
+	for position := offset; position < end; {
+		data, err := file.Seek(position, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			break
+		}
+		if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.EOPNOTSUPP) {
+			return []extent{{offset: offset, length: length}}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if data >= end {
+			break
+		}
+		hole, err := file.Seek(data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		if hole > end {
+			hole = end
+		}
+		extents = append(extents, extent{offset: data, length: hole - data})
+		position = hole
+	}
+	return extents, nil
+}
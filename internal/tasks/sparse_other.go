@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package tasks
+
+import "os"
+
+// dataExtents reports the whole range as data, holes are only found on linux.
+// Long zero runs are still left as holes by copySparseRange with CopyOptions.SparseZeroRuns.
+func dataExtents(_ *os.File, offset, length int64) ([]extent, error) {
+	if length == 0 {
+		return nil, nil
+	}
+	return []extent{{offset: offset, length: length}}, nil
+}
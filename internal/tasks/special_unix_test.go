@@ -0,0 +1,116 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package tasks
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFileRequest_Do_SpecialSource(t *testing.T) {
+	testCases := []struct {
+		special        string
+		expectedStatus bool
+	}{
+		{special: SpecialReport, expectedStatus: false},
+		{special: SpecialRecreate, expectedStatus: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.special, func(t *testing.T) {
+			// given
+			srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+			require.NoError(t, err)
+			targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+			require.NoError(t, err)
+			require.NoError(t, syscall.Mkfifo(filepath.Join(srcRootPath, "fifo"), 0640))
+			policy, err := ParseSpecialFilePolicy(tc.special)
+			require.NoError(t, err)
+			targetPath := filepath.Join(targetRootPath, "one", "fifo")
+			request := BackupFileRequest{
+				SourcePath: filepath.Join(srcRootPath, "fifo"),
+				TargetPath: targetPath,
+				Options:    CopyOptions{Special: policy, Preserve: PreserveOptions{Mode: true}},
+			}
+
+			// when
+			response := request.Do()
+
+			// then
+			assert.Equal(t, tc.expectedStatus, response.CompletionStatus, response.ErrorMessage)
+			assert.Equal(t, ActionSpecial, response.Action)
+			info, err := os.Lstat(targetPath)
+			if !tc.expectedStatus {
+				assert.True(t, os.IsNotExist(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.NotZero(t, info.Mode()&os.ModeNamedPipe)
+			assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+		})
+	}
+}
+
+func TestListSources_Special(t *testing.T) {
+	// given
+	srcRootDir, err := os.MkdirTemp("", "specialListSrcDir_*")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(srcRootDir, "file.txt"), []byte("data"), 0644))
+	require.NoError(t, syscall.Mkfifo(filepath.Join(srcRootDir, "fifo"), 0644))
+	testCases := []struct {
+		special         string
+		expectedFiles   []string
+		expectedSpecial int
+		expectedErrors  string
+	}{
+		{special: SpecialSkip, expectedFiles: []string{filepath.Join(srcRootDir, "file.txt")}, expectedErrors: "special-summary: skipped 1"},
+		{special: SpecialReport, expectedFiles: []string{filepath.Join(srcRootDir, "file.txt")}, expectedSpecial: 1},
+		{
+			special:         SpecialRecreate,
+			expectedFiles:   []string{filepath.Join(srcRootDir, "fifo"), filepath.Join(srcRootDir, "file.txt")},
+			expectedSpecial: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.special, func(t *testing.T) {
+			policy, err := ParseSpecialFilePolicy(tc.special)
+			require.NoError(t, err)
+			filesWriter := new(strings.Builder)
+			errorsWriter := new(strings.Builder)
+			specialWriter := new(strings.Builder)
+			lister, err := NewSourceLister(&NewSrcListerInput{
+				SrcRootDir:    srcRootDir,
+				DirsWriter:    new(strings.Builder),
+				FilesWriter:   filesWriter,
+				ErrorsWriter:  errorsWriter,
+				SpecialWriter: specialWriter,
+				Special:       policy,
+			})
+			require.NoError(t, err)
+
+			// when
+			err = lister.Do()
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Join(tc.expectedFiles, "\n")+"\n", filesWriter.String())
+			records, err := csv.NewReader(strings.NewReader(specialWriter.String())).ReadAll()
+			require.NoError(t, err)
+			require.Len(t, records, tc.expectedSpecial+1)
+			assert.Equal(t, specialHeader, records[0])
+			if tc.expectedSpecial > 0 {
+				assert.Equal(t, []string{SpecialFIFO, tc.special}, records[1][:2])
+				assert.Equal(t, filepath.Join(srcRootDir, "fifo"), records[1][4])
+			}
+			assert.Contains(t, errorsWriter.String(), tc.expectedErrors)
+			assert.NotContains(t, errorsWriter.String(), "unexpected_element")
+		})
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package tasks
+
+import (
+	"io/fs"
+	"time"
+)
+
+func accessTime(fi fs.FileInfo) time.Time {
+	return fi.ModTime()
+}
+
+func fileOwner(_ fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+func fileIdentity(_ fs.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	return 0, 0, 0, false
+}
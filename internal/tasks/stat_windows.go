@@ -0,0 +1,23 @@
+package tasks
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func accessTime(fi fs.FileInfo) time.Time {
+	data, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return fi.ModTime()
+	}
+	return time.Unix(0, data.LastAccessTime.Nanoseconds())
+}
+
+func fileOwner(_ fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+func fileIdentity(_ fs.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	return 0, 0, 0, false
+}
@@ -0,0 +1,220 @@
+package tasks
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AppleGamer22/recursive-backup/internal/listfile"
+	val "github.com/AppleGamer22/recursive-backup/internal/validationhelpers"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// DeleteReport only lists the target entries whose source was deleted
+	DeleteReport = "report"
+	// DeleteTrash moves the target entries whose source was deleted into TrashDir
+	DeleteTrash = "trash"
+	// DeleteRemove removes the target entries whose source was deleted
+	DeleteRemove = "remove"
+)
+
+// TrashDirName is the directory of the target root holding the entries moved by DeleteTrash, one sub directory per run
+const TrashDirName = ".rb-trash"
+
+// ValidateDeletePolicy validates a delete policy, empty means DeleteReport
+func ValidateDeletePolicy(policy string) error {
+	switch policy {
+	case "", DeleteReport, DeleteTrash, DeleteRemove:
+		return nil
+	default:
+		return fmt.Errorf("unknown delete policy %q, expecting %s, %s or %s", policy, DeleteReport, DeleteTrash, DeleteRemove)
+	}
+}
+
+// deletionsHeader is the header of the CSV deletions list
+var deletionsHeader = []string{"type", "action", "path", "error"}
+
+type TargetDeletionsAPI interface {
+	Do() (DeletionsResult, error)
+	DoContext(ctx context.Context) (DeletionsResult, error)
+}
+
+// DeletionsResult counts the target entries handled by a TargetDeletionsAPI
+type DeletionsResult struct {
+	// Deleted counts the entries whose source was deleted, they are reported, trashed or removed by the policy
+	Deleted uint
+	// Kept counts the entries missing from the source lists whose source still exists, e.g. excluded or unreadable ones
+	Kept uint
+	// Failed counts the deleted entries that could not be trashed or removed
+	Failed uint
+}
+
+type targetDeletions struct {
+	SrcRootDir    string
+	TargetRootDir string
+	Policy        string
+	TrashDir      string
+	listed        map[string]bool
+	srcLists      []io.Reader
+	deletions     *csv.Writer
+	result        DeletionsResult
+}
+
+type NewTargetDeletionsInput struct {
+	SrcRootDir    string
+	TargetRootDir string
+	// SrcDirsList and SrcFilesList are the lists of the source written by the lister, in any listfile format
+	SrcDirsList  io.Reader
+	SrcFilesList io.Reader
+	// DeletionsWriter receives the type, action, path and error of the target entries whose source was deleted as CSV
+	DeletionsWriter io.Writer
+	// Policy is DeleteReport, DeleteTrash or DeleteRemove, empty means DeleteReport
+	Policy string
+	// TrashDir receives the entries trashed by DeleteTrash under their path relative to the target root
+	TrashDir string
+}
+
+func (i *NewTargetDeletionsInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.SrcRootDir, validation.Required),
+		validation.Field(&i.TargetRootDir, validation.Required, validation.By(val.CheckDirReadable)),
+		validation.Field(&i.SrcDirsList, validation.Required, validation.NotNil),
+		validation.Field(&i.SrcFilesList, validation.Required, validation.NotNil),
+		validation.Field(&i.DeletionsWriter, validation.Required, validation.NotNil),
+		validation.Field(&i.Policy, validation.By(func(interface{}) error {
+			return ValidateDeletePolicy(i.Policy)
+		})),
+		validation.Field(&i.TrashDir, validation.When(i.Policy == DeleteTrash, validation.Required)),
+	)
+}
+
+// NewTargetDeletions returns the task finding the entries of the target root missing from the source lists.
+// An entry is only handled by the policy when its source path does not exist, so entries left out of the lists by
+// a filter, the list criteria or a listing error are kept.
+func NewTargetDeletions(input *NewTargetDeletionsInput) (TargetDeletionsAPI, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	policy := input.Policy
+	if len(policy) == 0 {
+		policy = DeleteReport
+	}
+	return &targetDeletions{
+		SrcRootDir:    filepath.Clean(input.SrcRootDir),
+		TargetRootDir: filepath.Clean(input.TargetRootDir),
+		Policy:        policy,
+		TrashDir:      input.TrashDir,
+		listed:        make(map[string]bool),
+		srcLists:      []io.Reader{input.SrcDirsList, input.SrcFilesList},
+		deletions:     csv.NewWriter(input.DeletionsWriter),
+	}, nil
+}
+
+func (t *targetDeletions) Do() (DeletionsResult, error) {
+	return t.DoContext(context.Background())
+}
+
+// DoContext stops walking the target once ctx is done and returns a wrapped ctx.Err(), the entries handled so far are listed
+func (t *targetDeletions) DoContext(ctx context.Context) (DeletionsResult, error) {
+	for _, list := range t.srcLists {
+		if err := t.readSourceList(list); err != nil {
+			return t.result, err
+		}
+	}
+	if err := t.deletions.Write(deletionsHeader); err != nil {
+		return t.result, err
+	}
+	err := filepath.WalkDir(t.TargetRootDir, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("finding deletions in %s stopped: %w", t.TargetRootDir, ctxErr)
+		}
+		if err != nil {
+			return err
+		}
+		if path == t.TargetRootDir {
+			return nil
+		}
+		if t.isOwnEntry(path, d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if t.listed[path] {
+			return nil
+		}
+		t.handle(path, d)
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	t.deletions.Flush()
+	if err == nil {
+		err = t.deletions.Error()
+	}
+	return t.result, err
+}
+
+// readSourceList records the target path of every listed source path
+func (t *targetDeletions) readSourceList(list io.Reader) error {
+	reader := listfile.NewReader(list)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		t.listed[filepath.Join(t.TargetRootDir, strings.TrimPrefix(record.Path, t.SrcRootDir))] = true
+	}
+}
+
+// isOwnEntry reports whether a target entry belongs to the backup itself, the trash and unfinished copies
+func (t *targetDeletions) isOwnEntry(path string, d fs.DirEntry) bool {
+	if d.IsDir() {
+		return path == filepath.Join(t.TargetRootDir, TrashDirName)
+	}
+	name := d.Name()
+	return isTempFileName(name) || (strings.HasPrefix(name, ".") &&
+		(strings.HasSuffix(name, PartialFileSuffix) || strings.HasSuffix(name, CheckpointFileSuffix)))
+}
+
+// handle applies the policy to an unlisted target entry whose source path does not exist, a directory with its contents
+func (t *targetDeletions) handle(path string, d fs.DirEntry) {
+	srcPath := filepath.Join(t.SrcRootDir, strings.TrimPrefix(path, t.TargetRootDir))
+	if _, err := os.Lstat(srcPath); !os.IsNotExist(err) {
+		t.result.Kept++
+		return
+	}
+	t.result.Deleted++
+	var err error
+	switch t.Policy {
+	case DeleteTrash:
+		trashPath := filepath.Join(t.TrashDir, strings.TrimPrefix(path, t.TargetRootDir))
+		if err = os.MkdirAll(filepath.Dir(trashPath), 0755); err == nil {
+			err = os.Rename(path, trashPath)
+		}
+	case DeleteRemove:
+		err = os.RemoveAll(path)
+	}
+	kind := "file"
+	if d.IsDir() {
+		kind = "dir"
+	}
+	errorMessage := ""
+	if err != nil {
+		t.result.Failed++
+		errorMessage = err.Error()
+	}
+	fmt.Printf("%s %s %s %s\n", t.Policy, kind, path, errorMessage)
+	_ = t.deletions.Write([]string{kind, t.Policy, path, errorMessage})
+}
@@ -0,0 +1,117 @@
+package tasks
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetDeletions_Do(t *testing.T) {
+	testCases := []struct {
+		policy            string
+		expectedRemaining []string
+		expectedTrash     []string
+	}{
+		{
+			policy:            DeleteReport,
+			expectedRemaining: []string{"excluded.txt", "file.txt", "gone.txt", "gone_dir", "kept"},
+		},
+		{
+			policy:            DeleteTrash,
+			expectedRemaining: []string{TrashDirName, "excluded.txt", "file.txt", "kept"},
+			expectedTrash:     []string{"gone.txt", "gone_dir"},
+		},
+		{
+			policy:            DeleteRemove,
+			expectedRemaining: []string{"excluded.txt", "file.txt", "kept"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			// given
+			srcRootDir, err := os.MkdirTemp("", "deletionsSrcDir_*")
+			require.NoError(t, err)
+			targetRootDir, err := os.MkdirTemp("", "deletionsTargetDir_*")
+			require.NoError(t, err)
+			for _, root := range []string{srcRootDir, targetRootDir} {
+				require.NoError(t, os.MkdirAll(filepath.Join(root, "kept"), 0755))
+				require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("data"), 0644))
+				require.NoError(t, os.WriteFile(filepath.Join(root, "excluded.txt"), []byte("data"), 0644))
+			}
+			require.NoError(t, os.WriteFile(filepath.Join(targetRootDir, "gone.txt"), []byte("data"), 0644))
+			require.NoError(t, os.MkdirAll(filepath.Join(targetRootDir, "gone_dir", "sub"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(targetRootDir, "gone_dir", "sub", "file.txt"), []byte("data"), 0644))
+			dirsList := strings.Join([]string{srcRootDir, filepath.Join(srcRootDir, "kept")}, "\n") + "\n"
+			filesList := filepath.Join(srcRootDir, "file.txt") + "\n"
+			deletionsWriter := new(strings.Builder)
+			trashDir := filepath.Join(targetRootDir, TrashDirName, "run")
+			task, err := NewTargetDeletions(&NewTargetDeletionsInput{
+				SrcRootDir:      srcRootDir,
+				TargetRootDir:   targetRootDir,
+				SrcDirsList:     strings.NewReader(dirsList),
+				SrcFilesList:    strings.NewReader(filesList),
+				DeletionsWriter: deletionsWriter,
+				Policy:          tc.policy,
+				TrashDir:        trashDir,
+			})
+			require.NoError(t, err)
+
+			// when
+			result, err := task.Do()
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, DeletionsResult{Deleted: 2, Kept: 1}, result)
+			assert.Equal(t, tc.expectedRemaining, dirNames(t, targetRootDir))
+			if len(tc.expectedTrash) > 0 {
+				assert.Equal(t, tc.expectedTrash, dirNames(t, trashDir))
+				assert.FileExists(t, filepath.Join(trashDir, "gone_dir", "sub", "file.txt"))
+			}
+			records, err := csv.NewReader(strings.NewReader(deletionsWriter.String())).ReadAll()
+			require.NoError(t, err)
+			assert.Equal(t, [][]string{
+				deletionsHeader,
+				{"file", tc.policy, filepath.Join(targetRootDir, "gone.txt"), ""},
+				{"dir", tc.policy, filepath.Join(targetRootDir, "gone_dir"), ""},
+			}, records)
+		})
+	}
+}
+
+func TestNewTargetDeletions_Validate(t *testing.T) {
+	// given
+	targetRootDir, err := os.MkdirTemp("", "deletionsTargetDir_*")
+	require.NoError(t, err)
+	input := NewTargetDeletionsInput{
+		SrcRootDir:      "/src",
+		TargetRootDir:   targetRootDir,
+		SrcDirsList:     strings.NewReader(""),
+		SrcFilesList:    strings.NewReader(""),
+		DeletionsWriter: new(strings.Builder),
+	}
+
+	// when, then
+	_, err = NewTargetDeletions(&input)
+	assert.NoError(t, err)
+	input.Policy = "purge"
+	_, err = NewTargetDeletions(&input)
+	assert.Error(t, err)
+	input.Policy = DeleteTrash
+	_, err = NewTargetDeletions(&input)
+	assert.Error(t, err, "trash requires a trash dir")
+}
+
+func dirNames(t *testing.T, path string) []string {
+	entries, err := os.ReadDir(path)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
@@ -0,0 +1,279 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// walkOptions tunes walkDir
+type walkOptions struct {
+	// Workers is the number of directories read concurrently, zero or one walks sequentially like filepath.WalkDir
+	Workers int
+	// FollowSymlinks hands fn what symlinks point to under the link's path and walks linked directories,
+	// except for a directory already being walked above the link, which is reported to fn as an error
+	FollowSymlinks bool
+}
+
+// walkDir walks the tree rooted at root like filepath.WalkDir. With several workers fn is called concurrently and must be
+// safe for concurrent use. The entries of a directory are still visited in lexical order by a single goroutine, but there
+// is no order between directories. The first error other than fs.SkipDir stops the walk and is returned once the
+// directories being read are done.
+func walkDir(root string, opts walkOptions, fn fs.WalkDirFunc) error {
+	stat := os.Lstat
+	if opts.FollowSymlinks {
+		stat = os.Stat
+	}
+	info, err := stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		item := walkItem{path: root, d: &statDirEntry{info: info}}
+		err = fn(root, item.d, nil)
+		if err == nil && item.d.IsDir() {
+			if opts.FollowSymlinks {
+				item.ancestors = []fs.FileInfo{info}
+			}
+			w := &walker{walkOptions: opts, fn: fn}
+			if opts.Workers > 1 {
+				err = w.walkParallel(item)
+			} else {
+				err = w.walkSequential(item)
+			}
+		}
+	}
+	if errors.Is(err, fs.SkipDir) {
+		return nil
+	}
+	return err
+}
+
+type walker struct {
+	walkOptions
+	fn fs.WalkDirFunc
+}
+
+// walkSequential visits the entries of a directory and walks its subdirectories depth first
+func (w *walker) walkSequential(item walkItem) error {
+	entries, err := os.ReadDir(item.path)
+	if err != nil {
+		// like filepath.WalkDir, fn is called a second time for a directory that cannot be read
+		if err = w.fn(item.path, item.d, err); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		child, descend, err := w.visitEntry(item, entry)
+		if err == nil && descend {
+			err = w.walkSequential(child)
+		}
+		if errors.Is(err, fs.SkipDir) {
+			if child.d.IsDir() {
+				continue
+			}
+			// fs.SkipDir returned for a file skips the remaining entries of its directory
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *walker) walkParallel(root walkItem) error {
+	queue := newWalkQueue()
+	queue.push(root)
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				item, ok := queue.pop()
+				if !ok {
+					return
+				}
+				if err := w.readDir(item, queue); err != nil {
+					queue.fail(err)
+				}
+				queue.done()
+			}
+		}()
+	}
+	wg.Wait()
+	return queue.err
+}
+
+// readDir visits the entries of a directory, queueing the subdirectories fn does not skip
+func (w *walker) readDir(item walkItem, queue *walkQueue) error {
+	entries, err := os.ReadDir(item.path)
+	if err != nil {
+		if err = w.fn(item.path, item.d, err); err != nil && !errors.Is(err, fs.SkipDir) {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		child, descend, err := w.visitEntry(item, entry)
+		if errors.Is(err, fs.SkipDir) {
+			if child.d.IsDir() {
+				continue
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if descend {
+			queue.push(child)
+		}
+	}
+	return nil
+}
+
+// visitEntry calls fn for an entry of parent and reports whether the entry is a directory to walk
+func (w *walker) visitEntry(parent walkItem, entry fs.DirEntry) (walkItem, bool, error) {
+	child := walkItem{path: filepath.Join(parent.path, entry.Name()), d: entry}
+	if w.FollowSymlinks {
+		var err error
+		if child, err = follow(parent, child); err != nil {
+			return child, false, w.fn(child.path, child.d, err)
+		}
+	}
+	err := w.fn(child.path, child.d, nil)
+	return child, err == nil && child.d.IsDir(), err
+}
+
+// follow replaces a symlink entry with the entry it points to. A directory gets the file infos of its ancestors,
+// a symlink to one of them is a loop.
+func follow(parent walkItem, child walkItem) (walkItem, error) {
+	var info fs.FileInfo
+	var err error
+	switch {
+	case isSymlink(child.d):
+		if info, err = os.Stat(child.path); err != nil {
+			return child, err
+		}
+		child.d = &statDirEntry{info: info}
+		if !info.IsDir() {
+			return child, nil
+		}
+		for _, ancestor := range parent.ancestors {
+			if os.SameFile(ancestor, info) {
+				return child, fmt.Errorf("symlink loop, the link points to a directory above it")
+			}
+		}
+	case child.d.IsDir():
+		if info, err = child.d.Info(); err != nil {
+			return child, err
+		}
+	default:
+		return child, nil
+	}
+	child.ancestors = append(parent.ancestors[:len(parent.ancestors):len(parent.ancestors)], info)
+	return child, nil
+}
+
+type walkItem struct {
+	path string
+	d    fs.DirEntry
+	// ancestors are the file infos of the directories from the root down to this one, only kept when following symlinks
+	ancestors []fs.FileInfo
+}
+
+// walkQueue holds the directories waiting to be read. It is unbounded, since its consumers are also its producers.
+type walkQueue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// items are read last in first out, keeping the queue about as long as the tree is deep times its fan-out
+	items []walkItem
+	// active counts the queued directories and the ones being read, the walk is over once it drops to zero
+	active int
+	err    error
+}
+
+func newWalkQueue() *walkQueue {
+	q := &walkQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *walkQueue) push(item walkItem) {
+	q.mu.Lock()
+	q.items = append(q.items, item)
+	q.active++
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop waits for a directory to read, it returns false once the walk is over or failed
+func (q *walkQueue) pop() (walkItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && q.active > 0 && q.err == nil {
+		q.cond.Wait()
+	}
+	if q.err != nil || len(q.items) == 0 {
+		return walkItem{}, false
+	}
+	item := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return item, true
+}
+
+func (q *walkQueue) done() {
+	q.mu.Lock()
+	q.active--
+	last := q.active == 0
+	q.mu.Unlock()
+	if last {
+		q.cond.Broadcast()
+	}
+}
+
+// fail stops the walk, keeping the first error
+func (q *walkQueue) fail(err error) {
+	q.mu.Lock()
+	if q.err == nil {
+		q.err = err
+	}
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// statDirEntry is the fs.DirEntry of the walk root or of a followed symlink, whose fs.FileInfo is known in advance
+type statDirEntry struct {
+	info fs.FileInfo
+}
+
+func (d *statDirEntry) Name() string               { return d.info.Name() }
+func (d *statDirEntry) IsDir() bool                { return d.info.IsDir() }
+func (d *statDirEntry) Type() fs.FileMode          { return d.info.Mode().Type() }
+func (d *statDirEntry) Info() (fs.FileInfo, error) { return d.info, nil }
+
+// comparePaths orders paths the way filepath.WalkDir visits them, element by element, so a directory's entries
+// come right after it. It returns a negative number when a comes first.
+func comparePaths(a, b string) int {
+	separator := string(filepath.Separator)
+	for len(a) > 0 && len(b) > 0 {
+		var elemA, elemB string
+		elemA, a = splitFirst(a, separator)
+		elemB, b = splitFirst(b, separator)
+		if elemA != elemB {
+			return strings.Compare(elemA, elemB)
+		}
+	}
+	return len(a) - len(b)
+}
+
+func splitFirst(path, separator string) (string, string) {
+	if i := strings.Index(path, separator); i >= 0 {
+		return path[:i], path[i+len(separator):]
+	}
+	return path, ""
+}
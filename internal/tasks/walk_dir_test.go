@@ -0,0 +1,186 @@
+package tasks
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComparePaths(t *testing.T) {
+	// given
+	var paths []string
+	for _, path := range []string{"/a.txt", "/a/b", "/a", "/a/b/c", "/a-b", "/"} {
+		paths = append(paths, filepath.FromSlash(path))
+	}
+
+	// when
+	sort.Slice(paths, func(i, j int) bool {
+		return comparePaths(paths[i], paths[j]) < 0
+	})
+
+	// then
+	var expected []string
+	for _, path := range []string{"/", "/a", "/a/b", "/a/b/c", "/a-b", "/a.txt"} {
+		expected = append(expected, filepath.FromSlash(path))
+	}
+	assert.Equal(t, expected, paths)
+}
+
+// walkTree creates the files below root, directories are created along the way
+func walkTree(t *testing.T, files ...string) string {
+	root, err := os.MkdirTemp("", "walkDir_*")
+	require.NoError(t, err)
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+	}
+	return root
+}
+
+// visitedPaths collects the paths visited by concurrent walk funcs relative to root, in sorted order
+type visitedPaths struct {
+	mu    sync.Mutex
+	root  string
+	paths []string
+}
+
+func (v *visitedPaths) add(path string) {
+	relPath, _ := filepath.Rel(v.root, path)
+	v.mu.Lock()
+	v.paths = append(v.paths, filepath.ToSlash(relPath))
+	v.mu.Unlock()
+}
+
+func (v *visitedPaths) sorted() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	sort.Strings(v.paths)
+	return v.paths
+}
+
+func TestWalkDir_ParallelFirstErrorStopsWalk(t *testing.T) {
+	// given
+	root := walkTree(t, "a/1.txt", "b/1.txt", "c/1.txt", "d/1.txt", "e/1.txt", "f/1.txt")
+	errBoom := errors.New("boom")
+	visited := &visitedPaths{root: root}
+
+	// when
+	err := walkDir(root, walkOptions{Workers: 4}, func(path string, d fs.DirEntry, err error) error {
+		visited.add(path)
+		if path == root {
+			return nil
+		}
+		return errBoom
+	})
+
+	// then
+	assert.ErrorIs(t, err, errBoom)
+	assert.Equal(t, []string{".", "a"}, visited.sorted(), "no directory is read after the first error")
+}
+
+func TestWalkDir_ParallelErrorInSubdirectory(t *testing.T) {
+	// given
+	root := walkTree(t, "a/b/boom.txt", "a/b/ok.txt", "c/ok.txt")
+	errBoom := errors.New("boom")
+
+	// when
+	err := walkDir(root, walkOptions{Workers: 4}, func(path string, d fs.DirEntry, err error) error {
+		if d != nil && d.Name() == "boom.txt" {
+			return errBoom
+		}
+		return err
+	})
+
+	// then
+	assert.ErrorIs(t, err, errBoom)
+}
+
+func TestWalkDir_ParallelSkipDir(t *testing.T) {
+	testCases := []struct {
+		title    string
+		skipped  string
+		expected []string
+	}{
+		{
+			title:    "directory",
+			skipped:  "b",
+			expected: []string{".", "a", "a/1.txt", "a/2.txt", "b", "c", "c/1.txt"},
+		},
+		{
+			title:    "file skips the remaining entries of its directory",
+			skipped:  "a/1.txt",
+			expected: []string{".", "a", "a/1.txt", "b", "b/1.txt", "c", "c/1.txt"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			// given
+			root := walkTree(t, "a/1.txt", "a/2.txt", "b/1.txt", "c/1.txt")
+			visited := &visitedPaths{root: root}
+
+			// when
+			err := walkDir(root, walkOptions{Workers: 3}, func(path string, d fs.DirEntry, err error) error {
+				visited.add(path)
+				if path == filepath.Join(root, filepath.FromSlash(tc.skipped)) {
+					return fs.SkipDir
+				}
+				return err
+			})
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, visited.sorted())
+		})
+	}
+}
+
+func TestWalkDir_ParallelUnreadableDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions do not stop reading it on windows or as root")
+	}
+	// given
+	root := walkTree(t, "a/1.txt", "locked/1.txt", "z/1.txt")
+	locked := filepath.Join(root, "locked")
+	require.NoError(t, os.Chmod(locked, 0))
+	defer func() {
+		_ = os.Chmod(locked, 0755)
+	}()
+	visited := &visitedPaths{root: root}
+	var readErrors []error
+	var mu sync.Mutex
+
+	// when
+	err := walkDir(root, walkOptions{Workers: 3}, func(path string, d fs.DirEntry, err error) error {
+		visited.add(path)
+		if err != nil {
+			mu.Lock()
+			readErrors = append(readErrors, err)
+			mu.Unlock()
+		}
+		return nil
+	})
+
+	// then
+	assert.NoError(t, err)
+	require.Len(t, readErrors, 1)
+	assert.ErrorIs(t, readErrors[0], fs.ErrPermission)
+	assert.Equal(t, []string{".", "a", "a/1.txt", "locked", "locked", "z", "z/1.txt"}, visited.sorted(),
+		"fn is called a second time for the unreadable directory and the walk goes on")
+
+	// and when fn returns the read error
+	err = walkDir(root, walkOptions{Workers: 3}, func(path string, d fs.DirEntry, err error) error {
+		return err
+	})
+
+	// then
+	assert.ErrorIs(t, err, fs.ErrPermission)
+}
@@ -0,0 +1,120 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// minBurst lets a limiter with a very low rate still pass a full read
+	minBurst = maxReadSize
+	// maxReadSize bounds the bytes a Reader asks the limiter for at once, so concurrent readers share the rate evenly
+	maxReadSize = 32 << 10
+)
+
+// Limiter is a token bucket shared by all copies of a run. Its rate follows its schedule,
+// and it holds up to one second of tokens, so an idle link does not allow a burst of more than a second.
+type Limiter struct {
+	mu       sync.Mutex
+	schedule Schedule
+	now      func() time.Time
+	rate     int64
+	tokens   float64
+	last     time.Time
+}
+
+func NewLimiter(schedule Schedule) *Limiter {
+	return &Limiter{
+		schedule: schedule,
+		now:      time.Now,
+	}
+}
+
+// Rate returns the current rate in bytes per second, Unlimited if the limiter never waits
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.schedule.RateAt(l.now())
+}
+
+func (l *Limiter) String() string {
+	return l.schedule.String()
+}
+
+// WaitN takes n tokens and blocks until they are available or ctx is done
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("rate limit wait stopped: %w", ctx.Err())
+	}
+}
+
+// reserve takes n tokens, letting the bucket go into debt, and returns how long the caller waits for the debt to be repaid
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	rate := l.schedule.RateAt(now)
+	if rate == Unlimited {
+		l.rate = rate
+		return 0
+	}
+	burst := float64(rate)
+	if burst < minBurst {
+		burst = minBurst
+	}
+	if rate != l.rate || l.last.IsZero() {
+		l.rate = rate
+		l.tokens = burst
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+		if l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+}
+
+type reader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *Limiter
+}
+
+// NewReader returns a reader that takes a token from limiter for every byte it reads from r.
+// A nil limiter returns r unchanged.
+func NewReader(ctx context.Context, r io.Reader, limiter *Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, limiter: limiter}
+}
+
+func (t *reader) Read(p []byte) (int, error) {
+	if len(p) > maxReadSize {
+		p = p[:maxReadSize]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
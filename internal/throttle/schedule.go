@@ -0,0 +1,118 @@
+package throttle
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/utils"
+)
+
+// Unlimited is the rate of a limiter that never waits
+const Unlimited int64 = 0
+
+// Window applies Rate from Start until End, both offsets from local midnight.
+// A window whose End is not after its Start wraps around midnight.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+	Rate  int64
+}
+
+// Schedule selects the rate in bytes per second by the time of day, DefaultRate applies outside of all windows
+type Schedule struct {
+	DefaultRate int64
+	Windows     []Window
+}
+
+func (w Window) contains(offset time.Duration) bool {
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// RateAt returns the rate of the first window containing t, or DefaultRate
+func (s Schedule) RateAt(t time.Time) int64 {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	for _, w := range s.Windows {
+		if w.contains(offset) {
+			return w.Rate
+		}
+	}
+	return s.DefaultRate
+}
+
+func (s Schedule) String() string {
+	out := formatRate(s.DefaultRate)
+	for _, w := range s.Windows {
+		out += fmt.Sprintf(", %s-%s %s", formatClock(w.Start), formatClock(w.End), formatRate(w.Rate))
+	}
+	return out
+}
+
+// ParseRate parses a rate such as 20MiB/s or 512KB into bytes per second, 0 and "unlimited" disable the limit
+func ParseRate(s string) (int64, error) {
+	trimmed := strings.TrimSpace(s)
+	if strings.EqualFold(trimmed, "unlimited") {
+		return Unlimited, nil
+	}
+	rate, err := utils.ParseByteSize(strings.TrimSuffix(trimmed, "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return rate, nil
+}
+
+// ParseSchedule parses comma separated HH:MM-HH:MM=RATE windows, e.g. "08:00-18:00=5MiB/s,18:00-08:00=unlimited".
+// defaultRate applies outside of all windows.
+func ParseSchedule(s string, defaultRate int64) (Schedule, error) {
+	schedule := Schedule{DefaultRate: defaultRate}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return Schedule{}, fmt.Errorf("invalid schedule window %q, expecting HH:MM-HH:MM=RATE", item)
+		}
+		clocks := strings.SplitN(parts[0], "-", 2)
+		if len(clocks) != 2 {
+			return Schedule{}, fmt.Errorf("invalid schedule window %q, expecting HH:MM-HH:MM=RATE", item)
+		}
+		var w Window
+		var err error
+		if w.Start, err = parseClock(clocks[0]); err != nil {
+			return Schedule{}, err
+		}
+		if w.End, err = parseClock(clocks[1]); err != nil {
+			return Schedule{}, err
+		}
+		if w.Rate, err = ParseRate(parts[1]); err != nil {
+			return Schedule{}, err
+		}
+		schedule.Windows = append(schedule.Windows, w)
+	}
+	return schedule, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expecting HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+func formatRate(rate int64) string {
+	if rate == Unlimited {
+		return "unlimited"
+	}
+	return utils.FormatByteSize(rate) + "/s"
+}
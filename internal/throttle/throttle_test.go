@@ -0,0 +1,114 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	testCases := []struct {
+		input           string
+		expected        int64
+		isErrorExpected bool
+	}{
+		{input: "0", expected: Unlimited},
+		{input: "unlimited", expected: Unlimited},
+		{input: "20MiB/s", expected: 20 << 20},
+		{input: "512KB", expected: 512e3},
+		{input: "fast", isErrorExpected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			actual, err := ParseRate(tc.input)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestSchedule_RateAt(t *testing.T) {
+	// given
+	schedule, err := ParseSchedule("08:00-18:00=5MiB/s, 22:00-02:00=1MiB", 20<<20)
+	require.NoError(t, err)
+	at := func(hour, minute int) time.Time {
+		return time.Date(2022, 3, 14, hour, minute, 0, 0, time.Local)
+	}
+
+	// then
+	assert.Equal(t, int64(20<<20), schedule.RateAt(at(7, 59)))
+	assert.Equal(t, int64(5<<20), schedule.RateAt(at(8, 0)))
+	assert.Equal(t, int64(5<<20), schedule.RateAt(at(17, 59)))
+	assert.Equal(t, int64(20<<20), schedule.RateAt(at(18, 0)))
+	assert.Equal(t, int64(1<<20), schedule.RateAt(at(23, 30)))
+	assert.Equal(t, int64(1<<20), schedule.RateAt(at(1, 0)))
+	assert.Equal(t, "20.0MiB/s, 08:00-18:00 5.0MiB/s, 22:00-02:00 1.0MiB/s", schedule.String())
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, input := range []string{"08:00=5MiB", "08:00-18:00", "8am-6pm=5MiB", "08:00-18:00=fast"} {
+		_, err := ParseSchedule(input, Unlimited)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestLimiter_reserve(t *testing.T) {
+	// given
+	now := time.Date(2022, 3, 14, 12, 0, 0, 0, time.Local)
+	limiter := NewLimiter(Schedule{DefaultRate: 64 << 10})
+	limiter.now = func() time.Time { return now }
+
+	// then the first second of tokens passes without waiting
+	assert.Equal(t, time.Duration(0), limiter.reserve(64<<10))
+	// and the bucket debt is repaid at the limiter's rate
+	assert.Equal(t, 500*time.Millisecond, limiter.reserve(32<<10))
+	now = now.Add(time.Second)
+	assert.Equal(t, time.Duration(0), limiter.reserve(16<<10))
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	limiter := NewLimiter(Schedule{})
+	assert.Equal(t, time.Duration(0), limiter.reserve(1<<30))
+	assert.Equal(t, Unlimited, limiter.Rate())
+}
+
+func TestReader(t *testing.T) {
+	// given
+	data := bytes.Repeat([]byte("x"), 3*minBurst)
+	limiter := NewLimiter(Schedule{DefaultRate: 2 * minBurst})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// when
+	start := time.Now()
+	out, err := io.ReadAll(NewReader(ctx, bytes.NewReader(data), limiter))
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, data, out)
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestReader_Cancelled(t *testing.T) {
+	// given
+	limiter := NewLimiter(Schedule{DefaultRate: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	_, err := io.ReadAll(NewReader(ctx, bytes.NewReader(bytes.Repeat([]byte("x"), 2*minBurst)), limiter))
+
+	// then
+	assert.True(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseTimeOrAge parses either a UTC time in layout, like the --time flag, or an age such as 72h, 90m or 7d, which is subtracted from now
+func ParseTimeOrAge(s, layout string, now time.Time) (time.Time, error) {
+	trimmed := strings.TrimSpace(s)
+	if t, err := time.Parse(layout, trimmed); err == nil {
+		return t, nil
+	}
+	if strings.HasSuffix(trimmed, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(trimmed, "d"), 64)
+		if err == nil && days >= 0 {
+			return now.Add(-time.Duration(days * float64(24*time.Hour))), nil
+		}
+	} else if age, err := time.ParseDuration(trimmed); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time or age %q, expecting %s or a duration such as 72h or 7d", s, layout)
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeOrAge(t *testing.T) {
+	now := time.Date(2022, 3, 14, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		input           string
+		expected        time.Time
+		isErrorExpected bool
+	}{
+		{input: "72h", expected: now.Add(-72 * time.Hour)},
+		{input: "90m", expected: now.Add(-90 * time.Minute)},
+		{input: "7d", expected: now.AddDate(0, 0, -7)},
+		{input: "1.5d", expected: now.Add(-36 * time.Hour)},
+		{input: "20220301T080000", expected: time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)},
+		{input: "-1h", isErrorExpected: true},
+		{input: "yesterday", isErrorExpected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			actual, err := ParseTimeOrAge(tc.input, "20060102T150405", now)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tc.expected.Equal(actual), "expected %s, got %s", tc.expected, actual)
+		})
+	}
+}
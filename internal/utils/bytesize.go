@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseByteSize parses sizes such as 1024, 64KiB, 20MB or 1.5G into a number of bytes.
+// KB, MB, GB and TB are decimal units, while KiB, MiB, GiB, TiB and the single letter forms are binary units.
+func ParseByteSize(s string) (int64, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := 1.0
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(trimmed, unit.suffix) {
+			trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || math.IsNaN(value) || value < 0 {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which is out of range itself
+	bytes := value * multiplier
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("byte size %q is out of range", s)
+	}
+	return int64(bytes), nil
+}
+
+// FormatByteSize formats a number of bytes with the largest binary unit that keeps the value at or above one, e.g. 1.5GiB
+func FormatByteSize(n int64) string {
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	if n < 1<<10 {
+		return fmt.Sprintf("%dB", n)
+	}
+	value := float64(n)
+	unit := "B"
+	for _, u := range units {
+		if value < 1<<10 {
+			break
+		}
+		value /= 1 << 10
+		unit = u
+	}
+	return fmt.Sprintf("%.1f%s", value, unit)
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	testCases := []struct {
+		input           string
+		expected        int64
+		isErrorExpected bool
+	}{
+		{input: "0", expected: 0},
+		{input: "1024", expected: 1024},
+		{input: "512B", expected: 512},
+		{input: "64KiB", expected: 64 << 10},
+		{input: "20MB", expected: 20e6},
+		{input: "1.5G", expected: 3 << 29},
+		{input: "2 tib", expected: 2 << 40},
+		{input: "", isErrorExpected: true},
+		{input: "-1MiB", isErrorExpected: true},
+		{input: "ten", isErrorExpected: true},
+		{input: "NaN", isErrorExpected: true},
+		{input: "Inf", isErrorExpected: true},
+		{input: "+Inf", isErrorExpected: true},
+		{input: "1e400", isErrorExpected: true},
+		{input: "9223372036854775808", isErrorExpected: true},
+		{input: "8388608TiB", isErrorExpected: true},
+		{input: "8388607TiB", expected: 8388607 << 40},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			actual, err := ParseByteSize(tc.input)
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	assert.Equal(t, "0B", FormatByteSize(0))
+	assert.Equal(t, "1023B", FormatByteSize(1023))
+	assert.Equal(t, "1.0KiB", FormatByteSize(1024))
+	assert.Equal(t, "20.0MiB", FormatByteSize(20<<20))
+	assert.Equal(t, "1.5GiB", FormatByteSize(3<<29))
+	assert.Equal(t, "2048.0TiB", FormatByteSize(2<<50))
+}
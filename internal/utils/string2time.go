@@ -2,31 +2,37 @@ package utils
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"strings"
 	"time"
 )
 
-// Reads the first valid date from a given CSV's 3rd column
+// opLogListStart starts the operation log line written when a run starts listing its source
+const opLogListStart = "list start "
+
+// GetLastBackupExecutionTime returns the start time of the run that wrote the operation log at previousExecutionLogPath,
+// the time of its first list start line. Every operation log line ends with its time in the RFC1123Z format.
 func GetLastBackupExecutionTime(previousExecutionLogPath string) (time.Time, error) {
 	file, err := os.Open(previousExecutionLogPath)
 	if err != nil {
 		return time.Unix(0, 0), err
 	}
 	defer file.Close()
-	reader := bufio.NewReader(file)
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			return time.Unix(0, 0), err
-		} else if strings.HasPrefix(line, "ERROR: ") {
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, opLogListStart) {
 			continue
 		}
-		timezone := time.Now().Location()
-		timeColumn := strings.Split(line, ",")[2]
-		timeString := strings.Split(timeColumn, " +")[0]
-		t, _ := time.Parse("2006-01-02 15:04:05", timeString)
-		adjustedTime := t.In(timezone)
-		return adjustedTime, nil
+		t, err := time.Parse(time.RFC1123Z, strings.TrimPrefix(line, opLogListStart))
+		if err != nil {
+			return time.Unix(0, 0), fmt.Errorf("failed to parse the list start time of %s: %w", previousExecutionLogPath, err)
+		}
+		return t, nil
+	}
+	if err = scanner.Err(); err != nil {
+		return time.Unix(0, 0), err
 	}
+	return time.Unix(0, 0), fmt.Errorf("%s has no list start line", previousExecutionLogPath)
 }
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLastBackupExecutionTime(t *testing.T) {
+	testCases := []struct {
+		title           string
+		opLog           string
+		expected        time.Time
+		isErrorExpected bool
+	}{
+		{
+			title: "full run",
+			opLog: "init start Mon, 14 Mar 2022 11:59:58 +0000\n" +
+				"list start Mon, 14 Mar 2022 12:00:00 +0200\n" +
+				"list end Mon, 14 Mar 2022 12:05:00 +0200\n" +
+				"list start Mon, 14 Mar 2022 13:00:00 +0200\n",
+			expected: time.Date(2022, 3, 14, 10, 0, 0, 0, time.UTC),
+		},
+		{title: "no list", opLog: "init start Mon, 14 Mar 2022 11:59:58 +0000\n", isErrorExpected: true},
+		{title: "bad time", opLog: "list start yesterday\n", isErrorExpected: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			// given
+			opLogPath := filepath.Join(t.TempDir(), "oplog.log")
+			require.NoError(t, os.WriteFile(opLogPath, []byte(tc.opLog), 0600))
+
+			// when
+			actual, err := GetLastBackupExecutionTime(opLogPath)
+
+			// then
+			if tc.isErrorExpected {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tc.expected.Equal(actual), actual)
+		})
+	}
+}
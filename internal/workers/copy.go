@@ -1,7 +1,12 @@
 package workers
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+	"github.com/AppleGamer22/recursive-backup/internal/throttle"
 )
 
 type Copy interface {
@@ -14,34 +19,132 @@ type copyWorker struct {
 	SourceRootPath string
 	TargetRootPath string
 	QuitFunc       UpdateOnQuitFunc
+	RetryPolicy    RetryPolicy
+	Context        context.Context
+	Quit           chan struct{}
+	OnResponse     ResponseObserverFunc
+	RateLimiter    *throttle.Limiter
 }
 
 type UpdateOnQuitFunc func()
 
-func NewCopyWorker(id uint, srcRootPath, targetRootPath string, p chan tasks.GeneralRequest, quitFunc UpdateOnQuitFunc) {
+// ResponseObserverFunc is called with every response of a worker before it is sent to the request's response channel
+type ResponseObserverFunc func(response tasks.BackupFileResponse)
+
+type NewCopyWorkerInput struct {
+	ID             uint
+	SourceRootPath string
+	TargetRootPath string
+	Pipeline       chan tasks.GeneralRequest
+	QuitFunc       UpdateOnQuitFunc
+	RetryPolicy    RetryPolicy
+	// Context stops the copy in progress and cancels the requests that are still queued, a nil Context never cancels
+	Context context.Context
+	// Quit stops the worker once it is idle, letting a pool shrink without queueing a QuitRequest behind pending copies
+	Quit       chan struct{}
+	OnResponse ResponseObserverFunc
+	// RateLimiter is shared by all workers of a run to cap their total bandwidth, nil copies at full speed
+	RateLimiter *throttle.Limiter
+}
+
+func NewCopyWorker(in *NewCopyWorkerInput) {
 	worker := &copyWorker{
-		ID:             id,
-		Pipeline:       p,
-		SourceRootPath: srcRootPath,
-		TargetRootPath: targetRootPath,
-		QuitFunc:       quitFunc,
+		ID:             in.ID,
+		Pipeline:       in.Pipeline,
+		SourceRootPath: in.SourceRootPath,
+		TargetRootPath: in.TargetRootPath,
+		QuitFunc:       in.QuitFunc,
+		RetryPolicy:    in.RetryPolicy,
+		Context:        in.Context,
+		Quit:           in.Quit,
+		OnResponse:     in.OnResponse,
+		RateLimiter:    in.RateLimiter,
+	}
+	if worker.Context == nil {
+		worker.Context = context.Background()
 	}
 	go worker.Handle()
 }
 
 func (f *copyWorker) Handle() {
-	for task := range f.Pipeline {
+	for {
+		var task tasks.GeneralRequest
+		var ok bool
+		select {
+		case task, ok = <-f.Pipeline:
+			if !ok {
+				return
+			}
+		case <-f.Quit:
+			f.QuitFunc()
+			return
+		}
 		switch assertedRequest := task.(type) {
 		case tasks.BackupFileRequest:
 			assertedRequest.WorkerID = f.ID
-			response := assertedRequest.Do()
-			assertedRequest.ResponseChannel <- response
+			if f.RateLimiter != nil {
+				assertedRequest.Options.Limiter = f.RateLimiter
+			}
+			var response tasks.BackupFileResponse
+			if err := f.Context.Err(); err != nil {
+				response = assertedRequest.Interrupt(err)
+			} else {
+				response = f.doWithRetry(&assertedRequest)
+			}
+			f.respond(response, assertedRequest.ResponseChannel)
+		case tasks.BackupSymlinkRequest:
+			assertedRequest.WorkerID = f.ID
+			var response tasks.BackupFileResponse
+			if err := f.Context.Err(); err != nil {
+				response = assertedRequest.Interrupt(err)
+			} else {
+				response = assertedRequest.DoContext(f.Context)
+				response.Attempts = 1
+			}
+			f.respond(response, assertedRequest.ResponseChannel)
+		case tasks.BackupSpecialFileRequest:
+			assertedRequest.WorkerID = f.ID
+			var response tasks.BackupFileResponse
+			if err := f.Context.Err(); err != nil {
+				response = assertedRequest.Interrupt(err)
+			} else {
+				response = assertedRequest.DoContext(f.Context)
+				response.Attempts = 1
+			}
+			f.respond(response, assertedRequest.ResponseChannel)
 		case tasks.QuitRequest:
 			f.QuitFunc()
 			return
 		default:
 			return
 		}
+	}
+}
 
+func (f *copyWorker) respond(response tasks.BackupFileResponse, responseChannel chan tasks.BackupFileResponse) {
+	if f.OnResponse != nil {
+		f.OnResponse(response)
+	}
+	responseChannel <- response
+}
+
+// doWithRetry repeats a failed copy with exponential backoff while its error is retryable by the worker's policy
+func (f *copyWorker) doWithRetry(request *tasks.BackupFileRequest) tasks.BackupFileResponse {
+	var attempt uint = 1
+	for {
+		response := request.DoContext(f.Context)
+		response.Attempts = attempt
+		if response.CompletionStatus || attempt >= f.RetryPolicy.MaxAttempts || !f.RetryPolicy.IsRetryable(response.Err) {
+			return response
+		}
+		delay := f.RetryPolicy.Delay(attempt)
+		fmt.Printf("[w%d][b%d][f%d] retry %d/%d in %s: %s\n", f.ID, request.BatchID, request.FileID,
+			attempt, f.RetryPolicy.MaxAttempts-1, delay, response.ErrorMessage)
+		select {
+		case <-time.After(delay):
+		case <-f.Context.Done():
+			return response
+		}
+		attempt++
 	}
 }
@@ -0,0 +1,235 @@
+package workers
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+)
+
+const (
+	DefaultAdaptiveInterval = 10 * time.Second
+	DefaultMaxErrorRate     = 0.1
+	// throughputTolerance is the relative throughput change below which the adaptive pool keeps its size
+	throughputTolerance = 0.05
+)
+
+// PoolOptions sizes a Pool. Workers is the fixed size, or the initial size of an adaptive pool,
+// which then grows or shrinks by one worker per Interval within MinWorkers and MaxWorkers.
+type PoolOptions struct {
+	Workers      uint
+	Adaptive     bool
+	MinWorkers   uint
+	MaxWorkers   uint
+	Interval     time.Duration
+	MaxErrorRate float64
+}
+
+type Pool interface {
+	Size() uint
+	// Stop quits the workers once they are idle and waits for all of them, the pipeline should be drained first
+	Stop()
+}
+
+type pool struct {
+	options  PoolOptions
+	worker   NewCopyWorkerInput
+	onResize PoolResizeFunc
+	quit     chan struct{}
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	stopped  bool
+	size     uint
+	nextID   uint
+	files    uint64
+	failures uint64
+	bytes    uint64
+}
+
+// PoolResizeFunc is called after an adaptive pool changed its size
+type PoolResizeFunc func(from, to uint, throughput, errorRate float64)
+
+type NewPoolInput struct {
+	Options PoolOptions
+	// Worker is the input of every worker of the pool, the pool sets its ID, Quit and OnResponse
+	Worker   NewCopyWorkerInput
+	OnResize PoolResizeFunc
+}
+
+func NewPool(in *NewPoolInput) (Pool, error) {
+	opts := in.Options
+	if opts.Workers == 0 {
+		return nil, fmt.Errorf("a worker pool needs at least one worker")
+	}
+	if opts.Adaptive {
+		if opts.MinWorkers == 0 {
+			opts.MinWorkers = 1
+		}
+		if opts.MaxWorkers < opts.Workers || opts.MinWorkers > opts.Workers {
+			return nil, fmt.Errorf("workers (%d) must be between the minimum (%d) and maximum (%d) workers of an adaptive pool",
+				opts.Workers, opts.MinWorkers, opts.MaxWorkers)
+		}
+		if opts.Interval <= 0 {
+			opts.Interval = DefaultAdaptiveInterval
+		}
+		if opts.MaxErrorRate <= 0 {
+			opts.MaxErrorRate = DefaultMaxErrorRate
+		}
+	}
+	p := &pool{
+		options:  opts,
+		worker:   in.Worker,
+		onResize: in.OnResize,
+		quit:     make(chan struct{}, opts.Workers+opts.MaxWorkers),
+		stop:     make(chan struct{}),
+	}
+	for i := uint(0); i < opts.Workers; i++ {
+		p.addWorker()
+	}
+	if opts.Adaptive {
+		go p.adapt()
+	}
+	return p, nil
+}
+
+func (p *pool) Size() uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+func (p *pool) Stop() {
+	close(p.stop)
+	p.mu.Lock()
+	p.stopped = true
+	close(p.quit)
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *pool) addWorker() {
+	p.size++
+	p.nextID++
+	p.wg.Add(1)
+	in := p.worker
+	in.ID = p.nextID
+	in.Quit = p.quit
+	in.OnResponse = p.observe
+	in.QuitFunc = func() {
+		if p.worker.QuitFunc != nil {
+			p.worker.QuitFunc()
+		}
+		p.wg.Done()
+	}
+	NewCopyWorker(&in)
+}
+
+// removeWorker asks one idle worker to quit
+func (p *pool) removeWorker() {
+	p.size--
+	p.quit <- struct{}{}
+}
+
+func (p *pool) observe(response tasks.BackupFileResponse) {
+	atomic.AddUint64(&p.files, 1)
+	atomic.AddUint64(&p.bytes, uint64(response.BytesCopied))
+	if !response.CompletionStatus {
+		atomic.AddUint64(&p.failures, 1)
+	}
+	if p.worker.OnResponse != nil {
+		p.worker.OnResponse(response)
+	}
+}
+
+func (p *pool) adapt() {
+	ticker := time.NewTicker(p.options.Interval)
+	defer ticker.Stop()
+	var previous poolSample
+	direction := 1
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		sample := poolSample{
+			Files:    atomic.SwapUint64(&p.files, 0),
+			Failures: atomic.SwapUint64(&p.failures, 0),
+			Bytes:    atomic.SwapUint64(&p.bytes, 0),
+			Interval: p.options.Interval,
+		}
+		p.mu.Lock()
+		if p.stopped {
+			p.mu.Unlock()
+			return
+		}
+		from := p.size
+		var to uint
+		to, direction = nextPoolSize(from, direction, sample, previous, p.options)
+		for p.size < to {
+			p.addWorker()
+		}
+		for p.size > to {
+			p.removeWorker()
+		}
+		p.mu.Unlock()
+		if sample.Files > 0 {
+			previous = sample
+		}
+		if from != to && p.onResize != nil {
+			p.onResize(from, to, sample.throughput(), sample.errorRate())
+		}
+	}
+}
+
+// poolSample holds the responses a pool observed during one adaptive interval
+type poolSample struct {
+	Files    uint64
+	Failures uint64
+	Bytes    uint64
+	Interval time.Duration
+}
+
+// throughput returns the copied bytes per second
+func (s poolSample) throughput() float64 {
+	if s.Interval <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Interval.Seconds()
+}
+
+func (s poolSample) errorRate() float64 {
+	if s.Files == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Files)
+}
+
+// nextPoolSize climbs towards the pool size with the best throughput. It keeps moving in the direction that raised
+// the throughput, turns around when the throughput drops and shrinks the pool while the error rate is too high.
+// An idle interval or a flat throughput keeps the size.
+func nextPoolSize(size uint, direction int, sample, previous poolSample, opts PoolOptions) (uint, int) {
+	switch {
+	case sample.Files == 0:
+		return size, direction
+	case sample.errorRate() > opts.MaxErrorRate:
+		direction = -1
+	case previous.Files == 0:
+		direction = 1
+	case sample.throughput() < previous.throughput()*(1-throughputTolerance):
+		direction = -direction
+	case sample.throughput() > previous.throughput()*(1+throughputTolerance):
+	default:
+		return size, direction
+	}
+	if direction > 0 && size < opts.MaxWorkers {
+		return size + 1, direction
+	}
+	if direction < 0 && size > opts.MinWorkers {
+		return size - 1, direction
+	}
+	return size, direction
+}
@@ -0,0 +1,99 @@
+package workers
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/tasks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextPoolSize(t *testing.T) {
+	opts := PoolOptions{MinWorkers: 1, MaxWorkers: 4, MaxErrorRate: 0.1}
+	fast := poolSample{Files: 10, Bytes: 2000, Interval: time.Second}
+	slow := poolSample{Files: 10, Bytes: 1000, Interval: time.Second}
+	failing := poolSample{Files: 10, Failures: 5, Bytes: 2000, Interval: time.Second}
+	testCases := []struct {
+		title             string
+		size              uint
+		direction         int
+		sample            poolSample
+		previous          poolSample
+		expectedSize      uint
+		expectedDirection int
+	}{
+		{title: "idle interval keeps the size", size: 2, direction: -1, sample: poolSample{Interval: time.Second}, previous: fast, expectedSize: 2, expectedDirection: -1},
+		{title: "first sample grows", size: 2, direction: -1, sample: slow, expectedSize: 3, expectedDirection: 1},
+		{title: "higher throughput keeps growing", size: 2, direction: 1, sample: fast, previous: slow, expectedSize: 3, expectedDirection: 1},
+		{title: "lower throughput turns around", size: 3, direction: 1, sample: slow, previous: fast, expectedSize: 2, expectedDirection: -1},
+		{title: "flat throughput keeps the size", size: 3, direction: 1, sample: fast, previous: fast, expectedSize: 3, expectedDirection: 1},
+		{title: "high error rate shrinks", size: 3, direction: 1, sample: failing, previous: slow, expectedSize: 2, expectedDirection: -1},
+		{title: "size stays within the maximum", size: 4, direction: 1, sample: fast, previous: slow, expectedSize: 4, expectedDirection: 1},
+		{title: "size stays within the minimum", size: 1, direction: 1, sample: failing, previous: slow, expectedSize: 1, expectedDirection: -1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			size, direction := nextPoolSize(tc.size, tc.direction, tc.sample, tc.previous, opts)
+			assert.Equal(t, tc.expectedSize, size)
+			assert.Equal(t, tc.expectedDirection, direction)
+		})
+	}
+}
+
+func TestNewPool_InvalidOptions(t *testing.T) {
+	_, err := NewPool(&NewPoolInput{Options: PoolOptions{}})
+	assert.Error(t, err)
+	_, err = NewPool(&NewPoolInput{Options: PoolOptions{Workers: 4, Adaptive: true, MaxWorkers: 2}})
+	assert.Error(t, err)
+}
+
+func TestPool_CopyAndStop(t *testing.T) {
+	// given
+	srcRootPath, err := os.MkdirTemp("", "srcDir_*")
+	require.NoError(t, err)
+	targetRootPath, err := os.MkdirTemp("", "testTarget_*")
+	require.NoError(t, err)
+	pipeline := make(chan tasks.GeneralRequest, 10)
+	responses := make(chan tasks.BackupFileResponse, 10)
+	var quitCount int32
+	pool, err := NewPool(&NewPoolInput{
+		Options: PoolOptions{Workers: 3},
+		Worker: NewCopyWorkerInput{
+			Pipeline: pipeline,
+			QuitFunc: func() { atomic.AddInt32(&quitCount, 1) },
+		},
+	})
+	require.NoError(t, err)
+	names := []string{"one.txt", "two.txt", "three.txt", "four.txt"}
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(srcRootPath, name), []byte(name), 0644))
+		pipeline <- tasks.BackupFileRequest{
+			CreationRequestTime: time.Now(),
+			SourcePath:          filepath.Join(srcRootPath, name),
+			TargetPath:          filepath.Join(targetRootPath, name),
+			ResponseChannel:     responses,
+		}
+	}
+
+	// when
+	var copied int64
+	for range names {
+		resp := <-responses
+		assert.True(t, resp.CompletionStatus)
+		copied += resp.BytesCopied
+	}
+	pool.Stop()
+
+	// then
+	assert.Equal(t, uint(3), pool.Size())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&quitCount))
+	assert.Equal(t, int64(len("one.txt")+len("two.txt")+len("three.txt")+len("four.txt")), copied)
+	for _, name := range names {
+		assert.FileExists(t, filepath.Join(targetRootPath, name))
+	}
+}
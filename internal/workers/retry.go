@@ -0,0 +1,101 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/rberrors"
+)
+
+const (
+	RetryOnEIO        = "eio"
+	RetryOnESTALE     = "estale"
+	RetryOnETIMEDOUT  = "etimedout"
+	RetryOnENOSPC     = "enospc"
+	RetryOnEAGAIN     = "eagain"
+	RetryOnECONNRESET = "econnreset"
+	RetryOnChecksum   = "checksum"
+	// DefaultRetryOn lists the error classes retried unless configured otherwise
+	DefaultRetryOn = "eio,estale,etimedout,enospc,checksum"
+)
+
+var retryableErrnos = map[string]syscall.Errno{
+	RetryOnEIO:        syscall.EIO,
+	RetryOnESTALE:     syscall.ESTALE,
+	RetryOnETIMEDOUT:  syscall.ETIMEDOUT,
+	RetryOnENOSPC:     syscall.ENOSPC,
+	RetryOnEAGAIN:     syscall.EAGAIN,
+	RetryOnECONNRESET: syscall.ECONNRESET,
+}
+
+// RetryPolicy decides whether a failed copy is attempted again and how long to wait before it
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, so values below 2 disable retries
+	MaxAttempts uint
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter randomizes each delay by up to the given fraction of it, in both directions
+	Jitter          float64
+	RetryableErrors []string
+}
+
+var jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+var jitterRandLock sync.Mutex
+
+// ParseRetryableErrors parses a comma separated list of error classes
+func ParseRetryableErrors(s string) ([]string, error) {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		class := strings.ToLower(strings.TrimSpace(item))
+		if class == "" {
+			continue
+		}
+		if _, ok := retryableErrnos[class]; !ok && class != RetryOnChecksum {
+			return nil, fmt.Errorf("unknown retryable error class %q", item)
+		}
+		out = append(out, class)
+	}
+	return out, nil
+}
+
+// IsRetryable reports whether err belongs to one of the policy's error classes
+func (p RetryPolicy) IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, class := range p.RetryableErrors {
+		if class == RetryOnChecksum {
+			if errors.As(err, &rberrors.ChecksumMismatchError{}) {
+				return true
+			}
+			continue
+		}
+		if errors.Is(err, retryableErrnos[class]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay returns the exponential backoff before the given retry, where retry 1 follows the first failed attempt
+func (p RetryPolicy) Delay(retry uint) time.Duration {
+	delay := p.BaseDelay
+	for i := uint(1); i < retry && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		jitterRandLock.Lock()
+		factor := 1 + p.Jitter*(2*jitterRand.Float64()-1)
+		jitterRandLock.Unlock()
+		delay = time.Duration(float64(delay) * factor)
+	}
+	return delay
+}
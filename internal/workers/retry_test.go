@@ -0,0 +1,58 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/AppleGamer22/recursive-backup/internal/rberrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_IsRetryable(t *testing.T) {
+	policy := RetryPolicy{RetryableErrors: []string{RetryOnEIO, RetryOnChecksum}}
+	testCases := []struct {
+		title    string
+		err      error
+		expected bool
+	}{
+		{title: "nil error", err: nil, expected: false},
+		{title: "wrapped EIO", err: &fs.PathError{Op: "read", Path: "/x", Err: syscall.EIO}, expected: true},
+		{title: "checksum mismatch", err: fmt.Errorf("copy: %w", rberrors.ChecksumMismatchError{}), expected: true},
+		{title: "not configured ENOSPC", err: &fs.PathError{Op: "write", Path: "/x", Err: syscall.ENOSPC}, expected: false},
+		{title: "plain error", err: errors.New("is not a regular file"), expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			assert.Equal(t, tc.expected, policy.IsRetryable(tc.err))
+		})
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	assert.Equal(t, time.Second, policy.Delay(1))
+	assert.Equal(t, 2*time.Second, policy.Delay(2))
+	assert.Equal(t, 4*time.Second, policy.Delay(3))
+	assert.Equal(t, 5*time.Second, policy.Delay(4))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(1)
+		assert.GreaterOrEqual(t, int64(delay), int64(500*time.Millisecond))
+		assert.LessOrEqual(t, int64(delay), int64(1500*time.Millisecond))
+	}
+}
+
+func TestParseRetryableErrors(t *testing.T) {
+	classes, err := ParseRetryableErrors(DefaultRetryOn)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{RetryOnEIO, RetryOnESTALE, RetryOnETIMEDOUT, RetryOnENOSPC, RetryOnChecksum}, classes)
+
+	_, err = ParseRetryableErrors("eio,enoent")
+	assert.Error(t, err)
+}